@@ -0,0 +1 @@
+document.getElementById("route").textContent = window.location.pathname;
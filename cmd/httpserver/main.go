@@ -1,25 +1,41 @@
 package main
 
 import (
-	"crypto/sha256"
-	"errors"
-	"fmt"
-	"io"
+	"embed"
+	"flag"
+	"io/fs"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/dump"
+	"github.com/mgmaster24/httpfromtcp/internal/fileserver"
 	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/middleware"
+	"github.com/mgmaster24/httpfromtcp/internal/proxy"
 	"github.com/mgmaster24/httpfromtcp/internal/request"
 	"github.com/mgmaster24/httpfromtcp/internal/response"
 	"github.com/mgmaster24/httpfromtcp/internal/server"
+	"github.com/mgmaster24/httpfromtcp/internal/vhost"
 )
 
 const port = 42069
 
+const maxBodySize = 10 << 20
+
+// dumpBodyLimit caps how much of each body -dump logs.
+const dumpBodyLimit = 1024
+
+// appHost serves the embedded single page app.
+const appHost = "app.localhost"
+
+//go:embed assets
+var assets embed.FS
+
 const HTML400 = `<html>
   <head>
     <title>400 Bad Request</title>
@@ -50,8 +66,60 @@ const HTMLOK = `<html>
   </body>
 </html>`
 
+// files serves the -static directory under /static/, when one is given.
+var files *fileserver.FileServer
+
+// httpbin forwards /httpbin/ requests to httpbin.org.
+var httpbin *proxy.Proxy
+
 func main() {
-	server, err := server.Serve(port, handler)
+	staticDir := flag.String("static", "", "directory to serve under /static/")
+	dumpTraffic := flag.Bool("dump", false, "log every request and response in wire format")
+	flag.Parse()
+	if *staticDir != "" {
+		files = fileserver.New(
+			os.DirFS(*staticDir),
+			fileserver.WithListings(),
+			fileserver.WithPrecompressed(),
+		)
+	}
+
+	var err error
+	httpbin, err = proxy.New("https://httpbin.org")
+	if err != nil {
+		log.Fatalf("Error creating the httpbin proxy: %v", err)
+	}
+
+	app, err := fs.Sub(assets, "assets")
+	if err != nil {
+		log.Fatalf("Error loading embedded assets: %v", err)
+	}
+	appFiles := fileserver.New(
+		app,
+		fileserver.WithContentETags(),
+		fileserver.WithImmutableFingerprints(),
+		fileserver.WithSPAFallback(),
+	)
+
+	router := vhost.NewRouter()
+	if err := router.Register(appHost, withMiddleware(appFiles.Handle)); err != nil {
+		log.Fatalf("Error registering %s: %v", appHost, err)
+	}
+	router.SetDefault(withMiddleware(handler))
+
+	opts := []server.Option{
+		server.WithDigestVerification(digest.SHA256, digest.SHA512),
+		server.WithMaxBodySize(maxBodySize),
+		server.WithRequestDecompression(),
+		server.WithStreamingBodies(),
+		server.WithServerName("httpfromtcp"),
+	}
+	if *dumpTraffic {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		opts = append(opts, server.WithDump(logger, dump.WithBodyLimit(dumpBodyLimit), dump.WithHexEscape()))
+	}
+
+	server, err := server.Serve(port, router.Handle, opts...)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -64,56 +132,25 @@ func main() {
 	log.Println("Server gracefully stopped")
 }
 
-func handler(w io.Writer, req *request.Request) {
-	writer := response.NewWriter(w)
+func withMiddleware(h server.Handler) server.Handler {
+	return middleware.ContentDigest(digest.SHA256)(
+		middleware.Compress(middleware.DefaultCompressMinSize)(middleware.ETag()(h)),
+	)
+}
+
+func handler(writer *response.Writer, req *request.Request) {
 	hdrs := headers.NewHeaders()
 	hdrs.Set("Content-Type", "text/html")
 
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin")
-		url := fmt.Sprintf("https://httpbin.org%s", target)
-		resp, err := http.Get(url)
-		if err != nil {
-			log.Printf("Error getting data from %s", url)
-			handle(writer, &hdrs, response.InternalServerError, HTML500)
-			return
-		}
-		defer resp.Body.Close()
-		writer.WriteStatusLine(response.StatusCode(resp.StatusCode))
-		hdrs.Set("Transfer-Encoding", "chunked")
-		for k, v := range resp.Header {
-			if k != "Content-Length" {
-				hdrs.Set(k, v[0])
-			}
-		}
-
-		writer.WriteHeaders(hdrs)
-		respBody := ""
-		buf := make([]byte, 1024)
-		for {
-			n, err := resp.Body.Read(buf)
-			if err != nil {
-				if errors.Is(io.EOF, err) {
-					// n, err = writer.WriteChunkedBodyDone()
-					break
-				}
-				log.Printf("Error reading from response. err: %e", err)
-				return
-			}
-
-			log.Printf("Bytes read. %d", n)
-			writer.WriteChunkedBody(buf[:n])
-			respBody = respBody + string(buf[:n])
-		}
-
-		log.Println("Writing Trailers")
-		trailers := headers.NewHeaders()
-		trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", sha256.Sum256([]byte(respBody))))
-		trailers.Set("X-Content-Length", fmt.Sprintf("%d", len(respBody)))
-		err = writer.WriteTrailers(trailers)
-		if err != nil {
-			log.Printf("error writing headers, err: %e", err)
-		}
+	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
+		req.RequestLine.RequestTarget = strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin")
+		httpbin.Handle(writer, req)
+		return
+	}
+
+	if files != nil && strings.HasPrefix(req.RequestLine.RequestTarget, "/static/") {
+		req.RequestLine.RequestTarget = strings.TrimPrefix(req.RequestLine.RequestTarget, "/static")
+		files.Handle(writer, req)
 		return
 	}
 
@@ -137,7 +174,6 @@ func handle(
 	body string,
 ) {
 	writer.WriteStatusLine(statusCode)
-	hdrs.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 	writer.WriteHeaders(*hdrs)
-	writer.WriteBody([]byte(body))
+	writer.Write([]byte(body))
 }
@@ -0,0 +1,96 @@
+// Package chunked parses bodies sent with the chunked transfer coding, for
+// both the request and the response parser.
+package chunked
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+)
+
+const crlf = "\r\n"
+
+type parserState int
+
+const (
+	parsingChunkSize parserState = iota
+	parsingChunkData
+	parsingTrailers
+	done
+)
+
+// Parser parses a chunked body incrementally, one piece at a time, the
+// way headers.Headers.Parse parses a header section.
+type Parser struct {
+	trailers       headers.Headers
+	state          parserState
+	chunkRemaining int
+}
+
+// NewParser returns a Parser that adds the trailer fields after the last
+// chunk to trailers.
+func NewParser(trailers headers.Headers) *Parser {
+	return &Parser{trailers: trailers}
+}
+
+// Parse parses the next piece of the body from data: a chunk size line,
+// chunk data, the CRLF that ends a chunk or a trailer field. It returns how
+// many bytes of data it consumed, the chunk data among them, and whether
+// the body and its trailers are complete. Consuming nothing without an
+// error means data holds too little to go on.
+func (p *Parser) Parse(data []byte) (int, []byte, bool, error) {
+	switch p.state {
+	case parsingChunkSize:
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			return 0, nil, false, nil
+		}
+
+		// Chunk extensions after ';' carry nothing we use.
+		sizeText, _, _ := strings.Cut(string(data[:idx]), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 32)
+		if err != nil || size < 0 {
+			return 0, nil, false, fmt.Errorf("invalid chunk size: %s", sizeText)
+		}
+
+		if size == 0 {
+			p.state = parsingTrailers
+		} else {
+			p.chunkRemaining = int(size)
+			p.state = parsingChunkData
+		}
+		return idx + len(crlf), nil, false, nil
+	case parsingChunkData:
+		if p.chunkRemaining > 0 {
+			n := min(len(data), p.chunkRemaining)
+			p.chunkRemaining -= n
+			return n, data[:n], false, nil
+		}
+
+		if len(data) < len(crlf) {
+			return 0, nil, false, nil
+		}
+
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, nil, false, fmt.Errorf("chunk data not followed by CRLF")
+		}
+
+		p.state = parsingChunkSize
+		return len(crlf), nil, false, nil
+	case parsingTrailers:
+		n, finished, err := p.trailers.Parse(data)
+		if err != nil {
+			return 0, nil, false, err
+		}
+
+		if finished {
+			p.state = done
+		}
+		return n, nil, finished, nil
+	default:
+		return 0, nil, false, fmt.Errorf("chunked body already complete")
+	}
+}
@@ -0,0 +1,64 @@
+package chunked
+
+import (
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseAll feeds data to p the way the message parsers do, with at most
+// step new bytes available at a time.
+func parseAll(p *Parser, data string, step int) (string, bool, error) {
+	var body []byte
+	buffered := 0
+	parsed := 0
+	for {
+		n, chunk, done, err := p.Parse([]byte(data[parsed:buffered]))
+		if err != nil {
+			return string(body), false, err
+		}
+
+		body = append(body, chunk...)
+		parsed += n
+		if done {
+			return string(body), true, nil
+		}
+
+		if n == 0 {
+			if buffered == len(data) {
+				return string(body), false, nil
+			}
+			buffered = min(buffered+step, len(data))
+		}
+	}
+}
+
+func TestParser(t *testing.T) {
+	// Test: Chunks, extensions and trailers, a byte at a time
+	trailers := headers.NewHeaders()
+	body, done, err := parseAll(NewParser(trailers), "5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nX-Checksum: abc\r\n\r\n", 1)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "hello, world", body)
+	assert.Equal(t, "abc", trailers["x-checksum"])
+
+	// Test: An empty body
+	body, done, err = parseAll(NewParser(headers.NewHeaders()), "0\r\n\r\n", 16)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Empty(t, body)
+
+	// Test: An unfinished body waits for more
+	body, done, err = parseAll(NewParser(headers.NewHeaders()), "5\r\nhel", 4)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, "hel", body)
+
+	// Test: Malformed chunks
+	_, _, err = parseAll(NewParser(headers.NewHeaders()), "zz\r\n", 8)
+	require.Error(t, err)
+	_, _, err = parseAll(NewParser(headers.NewHeaders()), "2\r\nhiX\r\n", 8)
+	require.Error(t, err)
+}
@@ -0,0 +1,446 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+)
+
+// Client sends requests and reads the responses with the project's own
+// parsers. Without a Transport every request gets a connection of its own.
+type Client struct {
+	// Timeout bounds dialing and waiting for the response headers; reading
+	// the body is not limited. Zero means no limit.
+	Timeout time.Duration
+	// TLSConfig is used for https URLs. A nil config uses the defaults.
+	TLSConfig *tls.Config
+	// Transport, when set, keeps connections alive and reuses them.
+	Transport *Transport
+}
+
+// chunkSize is the most a chunked request body sends per chunk.
+const chunkSize = 32 << 10
+
+// Response is a response read from a server. Body streams from the
+// connection and must be closed.
+type Response struct {
+	HttpVersion string
+	StatusCode  response.StatusCode
+	Reason      string
+	Headers     headers.Headers
+	// Trailers holds the trailer fields of a chunked body once Body has
+	// been read to EOF.
+	Trailers headers.Headers
+	Body     io.ReadCloser
+}
+
+// ErrRequestBody wraps errors reading the body of a request being sent, as
+// opposed to errors talking to the server.
+var ErrRequestBody = errors.New("reading request body")
+
+// Request is a request to send with Do.
+type Request struct {
+	Method string
+	// Target is the request target. In absolute form it names the server
+	// to connect to; otherwise the Host header does.
+	Target  string
+	Headers headers.Headers
+	// Body is streamed to the server after the head. Nil means no body.
+	Body io.Reader
+	// ContentLength is the length of Body. Bodies of unknown length, -1,
+	// are sent chunked.
+	ContentLength int64
+}
+
+// NewRequest builds a request for rawURL. The request target is kept in
+// absolute form so that Do knows where to connect; it is sent in origin
+// form. The length of a *bytes.Reader, *bytes.Buffer or *strings.Reader
+// body is known up front; any other body is sent chunked unless
+// ContentLength is set.
+func NewRequest(method string, rawURL string, body io.Reader) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported URL: %s", rawURL)
+	}
+
+	req := &Request{
+		Method:        method,
+		Target:        u.String(),
+		Headers:       headers.NewHeaders(),
+		Body:          body,
+		ContentLength: bodyLength(body),
+	}
+	req.Headers.Set("Host", u.Host)
+	return req, nil
+}
+
+func bodyLength(body io.Reader) int64 {
+	switch b := body.(type) {
+	case nil:
+		return 0
+	case *bytes.Reader:
+		return int64(b.Len())
+	case *bytes.Buffer:
+		return int64(b.Len())
+	case *strings.Reader:
+		return int64(b.Len())
+	}
+	return -1
+}
+
+// Get sends a GET request for rawURL.
+func (c *Client) Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req and reads the response head. A request target in absolute
+// form names the server to connect to; otherwise the Host header does and
+// plain HTTP is used. Interim 1xx responses are skipped. With a Transport,
+// an idempotent request without a body that fails on a reused connection
+// the server has since closed is retried.
+func (c *Client) Do(req *Request) (*Response, error) {
+	scheme, host, target, err := destination(req)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := hostPort(scheme, host)
+	key := scheme + "://" + addr
+	for {
+		var conn net.Conn
+		if c.Transport != nil {
+			conn = c.Transport.get(key)
+		}
+
+		reused := conn != nil
+		if !reused {
+			conn, err = c.dial(scheme, addr)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resp, keepAlive, err := c.roundTrip(conn, req, target)
+		if err != nil {
+			conn.Close()
+			if reused && req.Body == nil && isIdempotent(req.Method) && isStale(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		switch {
+		case resp.Body == nil:
+			// Nothing more to read, so the connection is done with now
+			// rather than whenever the caller closes the body.
+			resp.Body = io.NopCloser(strings.NewReader(""))
+			if keepAlive {
+				c.Transport.put(key, conn)
+			} else {
+				conn.Close()
+			}
+		case keepAlive:
+			resp.Body = &pooledBody{r: resp.Body, conn: conn, transport: c.Transport, key: key}
+		default:
+			resp.Body = &bodyCloser{Reader: resp.Body, conn: conn}
+		}
+		return resp, nil
+	}
+}
+
+// roundTrip writes req to conn and reads the response head. It reports
+// whether the connection can be pooled once the body has been read.
+func (c *Client) roundTrip(conn net.Conn, req *Request, target string) (*Response, bool, error) {
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	bw := bufio.NewWriter(conn)
+	chunked, err := writeHead(bw, req, target, c.Transport != nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if req.Body != nil {
+		// The body may come from a slow source, such as a client of the
+		// proxy; only the head and the wait for the response are timed.
+		conn.SetDeadline(time.Time{})
+		if err := writeBody(bw, req, chunked); err != nil {
+			return nil, false, err
+		}
+
+		if c.Timeout > 0 {
+			conn.SetDeadline(time.Now().Add(c.Timeout))
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, false, err
+	}
+
+	resp, keepAlive, err := readResponse(conn, req.Method)
+	if err != nil {
+		return nil, false, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return resp, keepAlive && c.Transport != nil, nil
+}
+
+// destination works out the scheme and host to connect to and the
+// origin-form target to send.
+func destination(req *Request) (string, string, string, error) {
+	target := req.Target
+	if strings.HasPrefix(target, "/") {
+		host, ok := req.Headers.Get("Host")
+		if !ok {
+			return "", "", "", fmt.Errorf("request has no Host header")
+		}
+		return "http", host, target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", "", fmt.Errorf("unsupported request target: %s", target)
+	}
+
+	origin := u.EscapedPath()
+	if origin == "" {
+		origin = "/"
+	}
+
+	if u.RawQuery != "" {
+		origin += "?" + u.RawQuery
+	}
+	return u.Scheme, u.Host, origin, nil
+}
+
+// hostPort adds the scheme's default port to host when it has none.
+func hostPort(scheme string, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	port := "80"
+	if scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+func (c *Client) dial(scheme string, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	if scheme != "https" {
+		return dialer.Dial("tcp", addr)
+	}
+
+	config := c.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, config)
+}
+
+// writeRequest serializes req with target as its request target.
+func writeRequest(w io.Writer, req *Request, target string, keepAlive bool) error {
+	chunked, err := writeHead(w, req, target, keepAlive)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, req, chunked)
+}
+
+// writeHead writes the request line and headers, framed for the body with
+// a Content-Length when its length is known and chunked otherwise. Unless
+// keepAlive is set the server is asked to close the connection after the
+// response. It reports whether the body is to be sent chunked.
+func writeHead(w io.Writer, req *Request, target string, keepAlive bool) (bool, error) {
+	h := headers.NewHeaders()
+	for name, value := range req.Headers {
+		h.Set(name, value)
+	}
+	h.Delete("Transfer-Encoding")
+	h.Delete("Content-Length")
+	if !keepAlive {
+		h.Replace("Connection", "close")
+	}
+
+	chunked := req.Body != nil && req.ContentLength < 0
+	switch {
+	case chunked:
+		h.Replace("Transfer-Encoding", "chunked")
+	case req.ContentLength > 0 || methodHasBody(req.Method):
+		h.Replace("Content-Length", strconv.FormatInt(max(req.ContentLength, 0), 10))
+	}
+
+	head := &request.Request{
+		Headers: h,
+		RequestLine: request.RequestLine{
+			HttpVersion:   "1.1",
+			RequestTarget: target,
+			Method:        req.Method,
+		},
+	}
+	return chunked, head.WriteHead(w)
+}
+
+// writeBody streams the body of req, flushing w after every read so that
+// the server gets each part as soon as it is available. Errors reading it
+// wrap ErrRequestBody.
+func writeBody(w io.Writer, req *Request, chunked bool) error {
+	if req.Body == nil {
+		return nil
+	}
+
+	body := req.Body
+	if !chunked {
+		body = io.LimitReader(body, req.ContentLength)
+	}
+
+	var written int64
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if err := writePart(w, buf[:n], chunked); err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrRequestBody, err)
+		}
+	}
+
+	if !chunked {
+		if written < req.ContentLength {
+			return fmt.Errorf("%w: body shorter than its Content-Length %d", ErrRequestBody, req.ContentLength)
+		}
+		return nil
+	}
+
+	_, err := io.WriteString(w, "0\r\n\r\n")
+	return err
+}
+
+func writePart(w io.Writer, p []byte, chunked bool) error {
+	var err error
+	if chunked {
+		_, err = fmt.Fprintf(w, "%x\r\n%s\r\n", len(p), p)
+	} else {
+		_, err = w.Write(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func methodHasBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
+}
+
+// readResponse parses the head of the final response from conn and sets
+// up a streaming reader for its body, leaving Body nil when the response
+// has none. It reports whether the connection can carry another request
+// after the body.
+func readResponse(conn io.Reader, method string) (*Response, bool, error) {
+	parsed, err := response.ResponseHeadFromReader(conn)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp := &Response{
+		HttpVersion: parsed.ResponseLine.HttpVersion,
+		StatusCode:  parsed.ResponseLine.StatusCode,
+		Reason:      parsed.ResponseLine.ReasonPhrase,
+		Headers:     parsed.Headers,
+		Trailers:    parsed.Trailers,
+	}
+
+	empty := method == "HEAD" || resp.StatusCode == response.NoContent ||
+		resp.StatusCode == response.NotModified
+	if length, ok := resp.Headers.ContentLength(); ok && length == 0 {
+		empty = true
+	}
+
+	if !empty {
+		resp.Body = io.NopCloser(parsed.BodyReader())
+	}
+	return resp, keepAlive(resp, empty), nil
+}
+
+// keepAlive reports whether the server left the connection open after
+// resp and its body has a known end.
+func keepAlive(resp *Response, empty bool) bool {
+	if resp.HttpVersion != "1.1" {
+		return false
+	}
+
+	if connection, ok := resp.Headers.Get("Connection"); ok {
+		for _, option := range strings.Split(connection, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "close") {
+				return false
+			}
+		}
+	}
+
+	if empty {
+		return true
+	}
+
+	if te, ok := resp.Headers.Get("Transfer-Encoding"); ok {
+		codings := strings.Split(te, ",")
+		return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+	}
+
+	_, ok := resp.Headers.ContentLength()
+	return ok
+}
+
+// bodyCloser closes the connection along with the body.
+type bodyCloser struct {
+	io.Reader
+	conn net.Conn
+}
+
+func (b *bodyCloser) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawServer answers one connection with reply after reading the request
+// head, and sends the request it read on the returned channel.
+func rawServer(t *testing.T, reply string) (string, <-chan *request.Request) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	requests := make(chan *request.Request, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := request.RequestFromReader(conn)
+		if err != nil {
+			close(requests)
+			return
+		}
+		requests <- req
+		conn.Write([]byte(reply))
+	}()
+	return "http://" + listener.Addr().String(), requests
+}
+
+func TestDo(t *testing.T) {
+	c := &Client{Timeout: time.Second}
+	read := func(resp *Response) string {
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// Test: Content-Length body, and the request as the server saw it
+	base, requests := rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nX-Reply: yes\r\n\r\nhello")
+	req, err := NewRequest("POST", base+"/submit?x=1", strings.NewReader("ping"))
+	require.NoError(t, err)
+	req.Headers.Set("Accept", "text/plain")
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, resp.StatusCode)
+	assert.Equal(t, "OK", resp.Reason)
+	assert.Equal(t, "yes", resp.Headers["x-reply"])
+	assert.Equal(t, "hello", read(resp))
+
+	got := <-requests
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.RequestLine.Method)
+	assert.Equal(t, "/submit?x=1", got.RequestLine.RequestTarget)
+	assert.Equal(t, "ping", string(got.Body))
+	assert.Equal(t, "text/plain", got.Headers["accept"])
+	assert.Equal(t, "close", got.Headers["connection"])
+	assert.Equal(t, "4", got.Headers["content-length"])
+
+	// Test: Bodies of unknown length are sent chunked
+	base, requests = rawServer(t, "HTTP/1.1 204 No Content\r\n\r\n")
+	req, err = NewRequest("PUT", base+"/upload", io.MultiReader(strings.NewReader("streamed "), strings.NewReader("body")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), req.ContentLength)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	got = <-requests
+	require.NotNil(t, got)
+	assert.Equal(t, "chunked", got.Headers["transfer-encoding"])
+	assert.Equal(t, "streamed body", string(got.Body))
+
+	// Test: Failing to read the body is reported as such
+	req, err = NewRequest("POST", base+"/upload", iotest.ErrReader(errors.New("client went away")))
+	require.NoError(t, err)
+	_, err = c.Do(req)
+	require.ErrorIs(t, err, ErrRequestBody)
+
+	// Test: Chunked body with trailers, after an interim response
+	base, _ = rawServer(t, "HTTP/1.1 103 Early Hints\r\nLink: </app.js>\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\n"+
+		"5;ext=1\r\nhello\r\n7\r\n, world\r\n0\r\nX-Checksum: abc\r\n\r\n")
+	resp, err = c.Get(base + "/")
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, resp.StatusCode)
+	assert.Equal(t, "hello, world", read(resp))
+	assert.Equal(t, "abc", resp.Trailers["x-checksum"])
+
+	// Test: Close delimited body
+	base, _ = rawServer(t, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the end")
+	resp, err = c.Get(base + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", resp.HttpVersion)
+	assert.Equal(t, "until the end", read(resp))
+
+	// Test: HEAD responses have no body whatever the headers say
+	base, _ = rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 500\r\n\r\n")
+	req, err = NewRequest("HEAD", base+"/", nil)
+	require.NoError(t, err)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "", read(resp))
+
+	// Test: A body cut short is an error
+	base, _ = rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 50\r\n\r\nshort")
+	resp, err = c.Get(base + "/")
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	resp.Body.Close()
+
+	// Test: Malformed status lines
+	base, _ = rawServer(t, "HTTP/2 200 OK\r\n\r\n")
+	_, err = c.Get(base + "/")
+	require.Error(t, err)
+}
+
+func TestWriteRequest(t *testing.T) {
+	req, err := NewRequest("GET", "https://example.com:8443/a%20b?q=1", nil)
+	require.NoError(t, err)
+	req.Headers.Set("X-B", "2")
+	req.Headers.Set("X-A", "1")
+
+	scheme, host, target, err := destination(req)
+	require.NoError(t, err)
+	assert.Equal(t, "https", scheme)
+	assert.Equal(t, "example.com:8443", host)
+	assert.Equal(t, "/a%20b?q=1", target)
+
+	var b strings.Builder
+	require.NoError(t, writeRequest(&b, req, target, false))
+	assert.Equal(t, "GET /a%20b?q=1 HTTP/1.1\r\n"+
+		"host: example.com:8443\r\n"+
+		"connection: close\r\n"+
+		"x-a: 1\r\n"+
+		"x-b: 2\r\n"+
+		"\r\n", b.String())
+
+	parsed, err := request.RequestFromReader(bufio.NewReader(strings.NewReader(b.String())))
+	require.NoError(t, err)
+	assert.Equal(t, "/a%20b?q=1", parsed.RequestLine.RequestTarget)
+
+	// Test: Pooled connections aren't asked to close
+	b.Reset()
+	require.NoError(t, writeRequest(&b, req, target, true))
+	assert.NotContains(t, b.String(), "connection:")
+}
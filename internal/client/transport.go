@@ -0,0 +1,227 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 2
+	DefaultIdleTimeout         = 90 * time.Second
+)
+
+// healthCheckWait is how long a pooled connection is watched for an EOF
+// or unexpected data before it is reused.
+const healthCheckWait = time.Millisecond
+
+// Transport keeps idle keep-alive connections for reuse, pooled per scheme
+// and host. A connection goes back to the pool once its response body has
+// been read to the end, unless the server asked to close it. Zero fields
+// use the defaults. A Transport is safe for concurrent use and may be
+// shared by several clients.
+type Transport struct {
+	// MaxIdleConns caps the idle connections across all hosts; the one
+	// idle the longest is closed to make room.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections to a single host.
+	MaxIdleConnsPerHost int
+	// IdleTimeout is how long a connection may sit idle before it is
+	// closed.
+	IdleTimeout time.Duration
+
+	mu    sync.Mutex
+	idle  map[string][]*idleConn
+	count int
+}
+
+type idleConn struct {
+	key   string
+	conn  net.Conn
+	since time.Time
+	timer *time.Timer
+}
+
+// get takes the most recently used healthy idle connection for key, or
+// returns nil when there is none.
+func (t *Transport) get(key string) net.Conn {
+	for {
+		t.mu.Lock()
+		conns := t.idle[key]
+		if len(conns) == 0 {
+			t.mu.Unlock()
+			return nil
+		}
+
+		ic := conns[len(conns)-1]
+		t.idle[key] = conns[:len(conns)-1]
+		t.count--
+		t.mu.Unlock()
+
+		ic.timer.Stop()
+		if healthy(ic.conn) {
+			return ic.conn
+		}
+		ic.conn.Close()
+	}
+}
+
+// put returns conn to the pool for key, evicting the oldest idle
+// connection when the pool is full.
+func (t *Transport) put(key string, conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.idle == nil {
+		t.idle = make(map[string][]*idleConn)
+	}
+
+	if len(t.idle[key]) >= orDefault(t.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost) {
+		conn.Close()
+		return
+	}
+
+	if t.count >= orDefault(t.MaxIdleConns, DefaultMaxIdleConns) {
+		t.evictOldestLocked()
+	}
+
+	ic := &idleConn{key: key, conn: conn, since: time.Now()}
+	idleTimeout := t.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	ic.timer = time.AfterFunc(idleTimeout, func() { t.evict(ic) })
+
+	t.idle[key] = append(t.idle[key], ic)
+	t.count++
+}
+
+// evict closes ic once its idle timeout passes, unless get took it first.
+func (t *Transport) evict(ic *idleConn) {
+	t.mu.Lock()
+	removed := t.removeLocked(ic)
+	t.mu.Unlock()
+
+	if removed {
+		ic.conn.Close()
+	}
+}
+
+func (t *Transport) evictOldestLocked() {
+	var oldest *idleConn
+	for _, conns := range t.idle {
+		if len(conns) > 0 && (oldest == nil || conns[0].since.Before(oldest.since)) {
+			oldest = conns[0]
+		}
+	}
+
+	if oldest != nil && t.removeLocked(oldest) {
+		oldest.timer.Stop()
+		oldest.conn.Close()
+	}
+}
+
+func (t *Transport) removeLocked(ic *idleConn) bool {
+	conns := t.idle[ic.key]
+	for i, c := range conns {
+		if c == ic {
+			t.idle[ic.key] = append(conns[:i], conns[i+1:]...)
+			t.count--
+			return true
+		}
+	}
+	return false
+}
+
+// CloseIdleConnections closes every idle connection in the pool.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.count = 0
+	t.mu.Unlock()
+
+	for _, conns := range idle {
+		for _, ic := range conns {
+			ic.timer.Stop()
+			ic.conn.Close()
+		}
+	}
+}
+
+// healthy reports whether an idle connection can carry another request.
+// The server may have closed it, or sent something unasked, while it sat
+// in the pool; either shows up as a read that doesn't time out.
+func healthy(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(healthCheckWait))
+	var b [1]byte
+	n, err := conn.Read(b[:])
+	conn.SetReadDeadline(time.Time{})
+	if n > 0 {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isStale reports whether err looks like the server closed a reused
+// connection before it saw the request.
+func isStale(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func orDefault(n int, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return n
+}
+
+// pooledBody hands the connection back to the transport once the body has
+// been read to the end. Closing it early closes the connection instead.
+type pooledBody struct {
+	r         io.Reader
+	conn      net.Conn
+	transport *Transport
+	key       string
+	done      bool
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+
+	n, err := b.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		b.done = true
+		b.transport.put(b.key, b.conn)
+	}
+	return n, err
+}
+
+func (b *pooledBody) Close() error {
+	if b.done {
+		return nil
+	}
+
+	b.done = true
+	return b.conn.Close()
+}
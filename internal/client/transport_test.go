@@ -0,0 +1,215 @@
+package client
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keepAliveServer answers requests on each connection it accepts with the
+// reply returned by respond, given the request's index on its connection.
+// An empty reply closes the connection without answering. It returns the
+// base URL and a counter of accepted connections.
+func keepAliveServer(t *testing.T, respond func(n int, req *request.Request) string) (string, *atomic.Int32) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+
+			go func() {
+				defer conn.Close()
+				for n := 0; ; n++ {
+					req, err := request.RequestFromReader(conn)
+					if err != nil {
+						return
+					}
+
+					reply := respond(n, req)
+					if reply == "" {
+						return
+					}
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	return "http://" + listener.Addr().String(), accepted
+}
+
+func get(t *testing.T, c *Client, method string, url string) (string, error) {
+	t.Helper()
+	req, err := NewRequest(method, url, nil)
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data), nil
+}
+
+func TestTransportReuse(t *testing.T) {
+	const ok = "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+
+	// Test: Sequential requests share one connection
+	var sawClose atomic.Bool
+	base, accepted := keepAliveServer(t, func(n int, req *request.Request) string {
+		if _, found := req.Headers.Get("Connection"); found {
+			sawClose.Store(true)
+		}
+		return ok
+	})
+	c := &Client{Timeout: time.Second, Transport: &Transport{}}
+	for range 3 {
+		body, err := get(t, c, "GET", base+"/")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", body)
+	}
+	assert.Equal(t, int32(1), accepted.Load())
+	assert.False(t, sawClose.Load())
+
+	// Test: Responses with no body release the connection right away,
+	// even when the body is only closed
+	for _, reply := range []string{
+		"HTTP/1.1 204 No Content\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+		"HTTP/1.1 304 Not Modified\r\nContent-Length: 2\r\n\r\n",
+	} {
+		base, accepted = keepAliveServer(t, func(n int, req *request.Request) string { return reply })
+		for range 2 {
+			resp, err := c.Get(base + "/")
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+		}
+		assert.Equal(t, int32(1), accepted.Load(), reply)
+	}
+
+	base, accepted = keepAliveServer(t, func(n int, req *request.Request) string {
+		return "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n"
+	})
+	for range 2 {
+		req, err := NewRequest("HEAD", base+"/", nil)
+		require.NoError(t, err)
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	assert.Equal(t, int32(1), accepted.Load())
+
+	// Test: Connection: close isn't pooled
+	base, accepted = keepAliveServer(t, func(n int, req *request.Request) string {
+		return "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\n\r\nok"
+	})
+	for range 2 {
+		_, err := get(t, c, "GET", base+"/")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), accepted.Load())
+
+	// Test: Idle connections expire
+	c = &Client{Timeout: time.Second, Transport: &Transport{IdleTimeout: 20 * time.Millisecond}}
+	base, accepted = keepAliveServer(t, func(n int, req *request.Request) string { return ok })
+	_, err := get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), accepted.Load())
+
+	// Test: Closing idle connections forces a new dial
+	c = &Client{Timeout: time.Second, Transport: &Transport{}}
+	base, accepted = keepAliveServer(t, func(n int, req *request.Request) string { return ok })
+	_, err = get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	c.Transport.CloseIdleConnections()
+	_, err = get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), accepted.Load())
+}
+
+func TestHealthy(t *testing.T) {
+	// Test: A quiet connection is healthy
+	a, b := net.Pipe()
+	assert.True(t, healthy(a))
+
+	// Test: Unexpected data from the server is not
+	go b.Write([]byte("HTTP/1.1 408 Request Timeout\r\n"))
+	assert.False(t, healthy(a))
+
+	// Test: Neither is a connection the server closed
+	b.Close()
+	assert.False(t, healthy(a))
+	a.Close()
+}
+
+func TestTransportStaleRetry(t *testing.T) {
+	// The server answers the first request on each connection and hangs up
+	// on the second, as if its idle timeout had fired in the meantime.
+	respond := func(n int, req *request.Request) string {
+		if n > 0 {
+			return ""
+		}
+		return "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	}
+
+	// Test: Idempotent requests are retried on a new connection
+	base, accepted := keepAliveServer(t, respond)
+	c := &Client{Timeout: time.Second, Transport: &Transport{}}
+	_, err := get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	body, err := get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, int32(2), accepted.Load())
+
+	// Test: Other requests are not
+	base, _ = keepAliveServer(t, respond)
+	_, err = get(t, c, "GET", base+"/")
+	require.NoError(t, err)
+	_, err = get(t, c, "POST", base+"/")
+	require.Error(t, err)
+}
+
+func TestTransportLimits(t *testing.T) {
+	tr := &Transport{MaxIdleConns: 2, MaxIdleConnsPerHost: 1}
+	pipe := func() net.Conn {
+		a, b := net.Pipe()
+		t.Cleanup(func() { b.Close() })
+		return a
+	}
+
+	a1, a2, b1, c1 := pipe(), pipe(), pipe(), pipe()
+	tr.put("a", a1)
+	tr.put("a", a2)
+	tr.put("b", b1)
+	tr.put("c", c1)
+
+	// Test: The per-host limit closes the extra connection, and the total
+	// limit evicts the oldest idle one
+	assert.Equal(t, 2, tr.count)
+	assert.Empty(t, tr.idle["a"])
+	for _, conn := range []net.Conn{a1, a2} {
+		_, err := conn.Write([]byte("x"))
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	}
+	tr.CloseIdleConnections()
+	assert.Equal(t, 0, tr.count)
+}
@@ -0,0 +1,197 @@
+package conditional
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+)
+
+// Validators describe the current representation of a resource. Either
+// field may be left empty when the handler doesn't have it.
+type Validators struct {
+	// ETag is the entity tag including its quotes, and the W/ prefix for
+	// a weak tag, e.g. `"v1"` or `W/"v1"`.
+	ETag         string
+	LastModified time.Time
+}
+
+// SetHeaders adds the ETag and Last-Modified fields for v to h.
+func (v Validators) SetHeaders(h headers.Headers) {
+	if v.ETag != "" {
+		h.Replace("ETag", v.ETag)
+	}
+
+	if !v.LastModified.IsZero() {
+		h.SetTime("Last-Modified", v.LastModified)
+	}
+}
+
+// Evaluate checks the request's preconditions against v in the order RFC
+// 9110 section 13.2.2 gives. It returns response.Ok when the request should
+// be served normally, response.NotModified when a GET or HEAD can be
+// answered with 304, or response.PreconditionFailed for 412.
+func Evaluate(req *request.Request, v Validators) response.StatusCode {
+	h := req.Headers
+	safe := req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD"
+
+	if ifMatch, ok := h.Get("If-Match"); ok {
+		if !matchesAny(ifMatch, v.ETag, StrongMatch) {
+			return response.PreconditionFailed
+		}
+	} else if since, ok := h.GetTime("If-Unmodified-Since"); ok && !v.LastModified.IsZero() {
+		if truncate(v.LastModified).After(since) {
+			return response.PreconditionFailed
+		}
+	}
+
+	if ifNoneMatch, ok := h.Get("If-None-Match"); ok {
+		if matchesAny(ifNoneMatch, v.ETag, WeakMatch) {
+			if safe {
+				return response.NotModified
+			}
+			return response.PreconditionFailed
+		}
+	} else if since, ok := h.GetTime("If-Modified-Since"); ok && safe && !v.LastModified.IsZero() {
+		if !truncate(v.LastModified).After(since) {
+			return response.NotModified
+		}
+	}
+
+	return response.Ok
+}
+
+// notModifiedFields are the fields of a 200 response that a 304 in its
+// place must repeat (RFC 9110 §15.4.5).
+var notModifiedFields = []string{"Cache-Control", "Content-Location", "Date", "Expires", "Vary"}
+
+// Check evaluates the request's preconditions and, when they call for it,
+// answers the request with 304 Not Modified or 412 Precondition Failed. h
+// holds the fields the full response would have been sent with; a 304
+// carries the validators and those of them a cache needs to update its
+// stored response. It reports whether it wrote a response, in which case
+// the handler must not write one.
+func Check(w *response.Writer, req *request.Request, v Validators, h headers.Headers) bool {
+	statusCode := Evaluate(req, v)
+	if statusCode == response.Ok {
+		return false
+	}
+
+	out := headers.NewHeaders()
+	if statusCode == response.NotModified {
+		for _, name := range notModifiedFields {
+			if value, ok := h.Get(name); ok {
+				out.Set(name, value)
+			}
+		}
+		v.SetHeaders(out)
+	}
+
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(out)
+	return true
+}
+
+// IfRange reports whether a Range header should be honoured given the
+// request's If-Range field. An entity tag must match v.ETag strongly and a
+// date must equal v.LastModified exactly. Requests without If-Range always
+// honour the range.
+func IfRange(req *request.Request, v Validators) bool {
+	ifRange, ok := req.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+
+	ifRange = strings.TrimSpace(ifRange)
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return StrongMatch(ifRange, v.ETag)
+	}
+
+	date, err := headers.ParseHTTPDate(ifRange)
+	if err != nil || v.LastModified.IsZero() {
+		return false
+	}
+	return truncate(v.LastModified).Equal(date)
+}
+
+// StrongMatch compares two entity tags with the strong comparison: both
+// must be strong and identical.
+func StrongMatch(a, b string) bool {
+	if a == "" || b == "" || isWeak(a) || isWeak(b) {
+		return false
+	}
+	return a == b
+}
+
+// WeakMatch compares two entity tags with the weak comparison, which
+// ignores the W/ prefix.
+func WeakMatch(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func isWeak(tag string) bool {
+	return strings.HasPrefix(tag, "W/")
+}
+
+// matchesAny reports whether current matches a member of an If-Match or
+// If-None-Match list. "*" matches any existing representation.
+func matchesAny(list string, current string, match func(a, b string) bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return current != ""
+	}
+
+	for _, tag := range ParseETags(list) {
+		if match(tag, current) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseETags splits a comma separated list of entity tags. Commas are
+// allowed inside the quotes of a tag, so the list is scanned rather than
+// split. Malformed members are skipped.
+func ParseETags(list string) []string {
+	var tags []string
+	for i := 0; i < len(list); {
+		switch list[i] {
+		case ' ', '\t', ',':
+			i++
+			continue
+		}
+
+		start := i
+		if strings.HasPrefix(list[i:], "W/") {
+			i += 2
+		}
+
+		if i >= len(list) || list[i] != '"' {
+			// Skip to the next member.
+			next := strings.IndexByte(list[i:], ',')
+			if next == -1 {
+				break
+			}
+			i += next
+			continue
+		}
+
+		end := strings.IndexByte(list[i+1:], '"')
+		if end == -1 {
+			break
+		}
+
+		i += end + 2
+		tags = append(tags, list[start:i])
+	}
+	return tags
+}
+
+// truncate drops sub-second precision, which HTTP-dates can't carry.
+func truncate(t time.Time) time.Time {
+	return t.Truncate(time.Second)
+}
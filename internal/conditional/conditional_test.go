@@ -0,0 +1,98 @@
+package conditional
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, method string, fields ...string) *request.Request {
+	t.Helper()
+	raw := method + " /index.html HTTP/1.1\r\nHost: localhost\r\n"
+	for _, field := range fields {
+		raw += field + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestEvaluate(t *testing.T) {
+	modified := time.Date(2024, time.March, 1, 12, 0, 0, 500, time.UTC)
+	v := Validators{ETag: `"v2"`, LastModified: modified}
+	before := "If-Modified-Since: Thu, 29 Feb 2024 12:00:00 GMT"
+	exact := "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"
+
+	// Test: No preconditions
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "GET"), v))
+
+	// Test: If-None-Match uses the weak comparison
+	assert.Equal(t, response.NotModified, Evaluate(newRequest(t, "GET", `If-None-Match: "v1", W/"v2"`), v))
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "GET", `If-None-Match: "v1"`), v))
+	assert.Equal(t, response.NotModified, Evaluate(newRequest(t, "HEAD", "If-None-Match: *"), v))
+	assert.Equal(t, response.PreconditionFailed, Evaluate(newRequest(t, "PUT", `If-None-Match: "v2"`), v))
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "GET", `If-None-Match: "v1"`, exact), v))
+
+	// Test: If-Modified-Since
+	assert.Equal(t, response.NotModified, Evaluate(newRequest(t, "GET", exact), v))
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "GET", before), v))
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "POST", exact), v))
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "GET", "If-Modified-Since: garbage"), v))
+
+	// Test: If-Match uses the strong comparison
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "PUT", `If-Match: "v1", "v2"`), v))
+	assert.Equal(t, response.PreconditionFailed, Evaluate(newRequest(t, "PUT", `If-Match: W/"v2"`), v))
+	assert.Equal(t, response.PreconditionFailed, Evaluate(newRequest(t, "PUT", "If-Match: *"), Validators{}))
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	assert.Equal(t, response.Ok, Evaluate(newRequest(t, "PUT", `If-Match: "v2"`,
+		"If-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT"), v))
+	assert.Equal(t, response.PreconditionFailed, Evaluate(newRequest(t, "PUT",
+		"If-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT"), v))
+}
+
+func TestIfRange(t *testing.T) {
+	modified := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	v := Validators{ETag: `"v2"`, LastModified: modified}
+
+	assert.True(t, IfRange(newRequest(t, "GET"), v))
+	assert.True(t, IfRange(newRequest(t, "GET", `If-Range: "v2"`), v))
+	assert.False(t, IfRange(newRequest(t, "GET", `If-Range: W/"v2"`), v))
+	assert.True(t, IfRange(newRequest(t, "GET", "If-Range: Fri, 01 Mar 2024 12:00:00 GMT"), v))
+	assert.False(t, IfRange(newRequest(t, "GET", "If-Range: Sat, 02 Mar 2024 12:00:00 GMT"), v))
+}
+
+func TestParseETags(t *testing.T) {
+	assert.Equal(t, []string{`"a"`, `W/"b,c"`, `""`}, ParseETags(`"a", W/"b,c" ,""`))
+	assert.Equal(t, []string{`"ok"`}, ParseETags(`bogus, "ok", "unterminated`))
+}
+
+func TestCheck(t *testing.T) {
+	v := Validators{ETag: `"v2"`}
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	req := newRequest(t, "GET", `If-None-Match: "v2"`)
+	w.SetRequest(req)
+
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Vary", "Accept-Encoding")
+	require.True(t, Check(w, req, v, h))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, buf.String(), "etag: \"v2\"\r\n")
+	assert.Contains(t, buf.String(), "cache-control: no-cache\r\n")
+	assert.Contains(t, buf.String(), "vary: Accept-Encoding\r\n")
+	assert.NotContains(t, buf.String(), "content-type")
+	assert.False(t, Check(response.NewWriter(&buf), newRequest(t, "GET"), v, nil))
+}
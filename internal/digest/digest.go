@@ -0,0 +1,121 @@
+package digest
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Algorithm is a hash algorithm key from the HTTP Digest Algorithm Values
+// registry of RFC 9530.
+type Algorithm string
+
+const (
+	SHA256 Algorithm = "sha-256"
+	SHA512 Algorithm = "sha-512"
+)
+
+// New returns a fresh hash for the algorithm, or nil when it isn't
+// supported.
+func (a Algorithm) New() hash.Hash {
+	switch a {
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	}
+	return nil
+}
+
+// Format renders digests as the value of a Content-Digest or Repr-Digest
+// field, a structured field dictionary of byte sequences such as
+// sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:
+func Format(algs []Algorithm, sums [][]byte) string {
+	parts := make([]string, len(algs))
+	for i, alg := range algs {
+		parts[i] = fmt.Sprintf("%s=:%s:", alg, base64.StdEncoding.EncodeToString(sums[i]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Parse reads a Content-Digest or Repr-Digest value into a digest per
+// algorithm. Algorithms this package doesn't know are kept as well, so
+// callers can tell an unsupported digest from a missing one.
+func Parse(value string) (map[Algorithm][]byte, error) {
+	sums := make(map[Algorithm][]byte)
+	for _, member := range strings.Split(value, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		key, encoded, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed digest: %s", member)
+		}
+
+		encoded = strings.TrimSpace(encoded)
+		if len(encoded) < 2 || encoded[0] != ':' || encoded[len(encoded)-1] != ':' {
+			return nil, fmt.Errorf("malformed digest: %s", member)
+		}
+
+		sum, err := base64.StdEncoding.DecodeString(encoded[1 : len(encoded)-1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed digest: %s", member)
+		}
+
+		sums[Algorithm(strings.ToLower(key))] = sum
+	}
+	return sums, nil
+}
+
+// FormatWant renders a Want-Content-Digest or Want-Repr-Digest value that
+// asks for the given algorithms, the first one most preferred.
+func FormatWant(algs []Algorithm) string {
+	parts := make([]string, len(algs))
+	for i, alg := range algs {
+		parts[i] = fmt.Sprintf("%s=%d", alg, max(10-i, 1))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Negotiate picks from algs, which are ordered by preference, the ones a
+// Want-Content-Digest or Want-Repr-Digest value asks for, most wanted
+// first. Algorithms with weight 0 are not wanted. If the value names none
+// of algs, the first of algs is returned so that a digest is still sent.
+func Negotiate(want string, algs []Algorithm) []Algorithm {
+	weights := make(map[Algorithm]int)
+	for _, member := range strings.Split(want, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		key, weight, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			continue
+		}
+
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || w < 0 || w > 10 {
+			continue
+		}
+		weights[Algorithm(strings.ToLower(key))] = w
+	}
+
+	var chosen []Algorithm
+	for _, alg := range algs {
+		if weights[alg] > 0 {
+			chosen = append(chosen, alg)
+		}
+	}
+
+	if len(chosen) == 0 {
+		if len(algs) == 0 {
+			return nil
+		}
+		return algs[:1]
+	}
+
+	sort.SliceStable(chosen, func(i, j int) bool {
+		return weights[chosen[i]] > weights[chosen[j]]
+	})
+	return chosen
+}
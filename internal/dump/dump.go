@@ -0,0 +1,213 @@
+// Package dump renders HTTP messages in wire format for debugging.
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+)
+
+const headEnd = "\r\n\r\n"
+
+// Option configures how bodies are rendered.
+type Option func(*options)
+
+type options struct {
+	bodyLimit int
+	hexEscape bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{bodyLimit: -1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithBodyLimit keeps at most n bytes of the body and notes how many were
+// left out. Zero leaves the body out entirely.
+func WithBodyLimit(n int) Option {
+	return func(o *options) {
+		o.bodyLimit = n
+	}
+}
+
+// WithHexEscape writes body bytes that aren't printable UTF-8 text as \xNN,
+// so binary bodies don't garble terminals and logs. Text bodies, line
+// breaks and tabs included, are left as they are.
+func WithHexEscape() Option {
+	return func(o *options) {
+		o.hexEscape = true
+	}
+}
+
+// Request renders req as Request.Write sends it, reading any body still on
+// the connection first.
+func Request(req *request.Request, opts ...Option) ([]byte, error) {
+	var b bytes.Buffer
+	if err := req.Write(&b); err != nil {
+		return nil, err
+	}
+	return Raw(b.Bytes(), opts...), nil
+}
+
+// Raw renders a message captured off the wire, such as the bytes a
+// response.Writer wrote. Everything up to the end of the head is kept
+// as is; interim 1xx responses count as part of the head, so the options
+// apply to the body of the final message, framing included. Data without
+// a complete head is returned unchanged.
+func Raw(data []byte, opts ...Option) []byte {
+	return render(data, 0, newOptions(opts))
+}
+
+func render(data []byte, omitted int, o options) []byte {
+	start := bodyStart(data)
+	if start == -1 {
+		return bytes.Clone(data)
+	}
+
+	body := data[start:]
+	if o.bodyLimit >= 0 && len(body) > o.bodyLimit {
+		omitted += len(body) - o.bodyLimit
+		body = body[:o.bodyLimit]
+	}
+
+	out := bytes.Clone(data[:start])
+	if o.hexEscape {
+		out = appendEscaped(out, body)
+	} else {
+		out = append(out, body...)
+	}
+
+	if omitted > 0 {
+		out = fmt.Appendf(out, "\n[%d more bytes]\n", omitted)
+	}
+	return out
+}
+
+// bodyStart returns the offset of the body of the final message in data,
+// or -1 while its head is incomplete.
+func bodyStart(data []byte) int {
+	start := 0
+	for {
+		idx := bytes.Index(data[start:], []byte(headEnd))
+		if idx == -1 {
+			return -1
+		}
+
+		end := start + idx + len(headEnd)
+		if !isInterim(data[start:end]) {
+			return end
+		}
+		start = end
+	}
+}
+
+// isInterim reports whether head is a 1xx response other than 101, which
+// ends the HTTP exchange on the connection rather than preceding another
+// response.
+func isInterim(head []byte) bool {
+	if !bytes.HasPrefix(head, []byte("HTTP/")) {
+		return false
+	}
+
+	_, rest, ok := bytes.Cut(head, []byte(" "))
+	return ok && len(rest) >= 3 && rest[0] == '1' && !bytes.HasPrefix(rest, []byte("101"))
+}
+
+func appendEscaped(out []byte, body []byte) []byte {
+	for len(body) > 0 {
+		r, size := utf8.DecodeRune(body)
+		if (r == utf8.RuneError && size == 1) ||
+			(!unicode.IsPrint(r) && r != '\r' && r != '\n' && r != '\t') {
+			for _, c := range body[:size] {
+				out = fmt.Appendf(out, "\\x%02x", c)
+			}
+		} else {
+			out = append(out, body[:size]...)
+		}
+		body = body[size:]
+	}
+	return out
+}
+
+// Recorder captures the bytes of a message on their way to w, for dumping
+// once the exchange is over. Wrap the destination of a response.Writer to
+// record a response, or tee a connection's reads into a Recorder with a
+// nil w to record a request exactly as it arrived. With WithBodyLimit only
+// the part of the body that will be dumped is kept in memory.
+type Recorder struct {
+	w       io.Writer
+	opts    options
+	buf     bytes.Buffer
+	start   int
+	omitted int
+}
+
+// NewRecorder returns a Recorder that passes writes on to w, which may be
+// nil to only record. The options apply to Dump.
+func NewRecorder(w io.Writer, opts ...Option) *Recorder {
+	return &Recorder{w: w, opts: newOptions(opts), start: -1}
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n := len(p)
+	if r.w != nil {
+		var err error
+		n, err = r.w.Write(p)
+		if err != nil {
+			r.record(p[:n])
+			return n, err
+		}
+	}
+
+	r.record(p)
+	return n, nil
+}
+
+func (r *Recorder) record(p []byte) {
+	if r.opts.bodyLimit < 0 {
+		r.buf.Write(p)
+		return
+	}
+
+	if r.start == -1 {
+		r.buf.Write(p)
+		r.start = bodyStart(r.buf.Bytes())
+		if r.start == -1 {
+			return
+		}
+
+		// The head just completed; whatever followed it is body.
+		p = bytes.Clone(r.buf.Bytes()[r.start:])
+		r.buf.Truncate(r.start)
+	}
+
+	keep := min(len(p), max(r.opts.bodyLimit-(r.buf.Len()-r.start), 0))
+	r.buf.Write(p[:keep])
+	r.omitted += len(p) - keep
+}
+
+// Flush flushes w when it buffers, so that wrapping a buffered writer
+// doesn't hold back interim responses such as 100 Continue.
+func (r *Recorder) Flush() error {
+	if f, ok := r.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Bytes returns what has been recorded so far.
+func (r *Recorder) Bytes() []byte {
+	return r.buf.Bytes()
+}
+
+// Dump renders the recorded message with the Recorder's options.
+func (r *Recorder) Dump() []byte {
+	return render(r.buf.Bytes(), r.omitted, r.opts)
+}
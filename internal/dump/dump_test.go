@@ -0,0 +1,82 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequest(t *testing.T) {
+	raw := "POST /upload HTTP/1.1\r\n" +
+		"host: localhost\r\n" +
+		"content-length: 10\r\n" +
+		"content-type: application/octet-stream\r\n" +
+		"\r\n" +
+		"ab\x00\x01\xffcdéf"
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	// Test: Without options the dump is the wire format
+	got, err := Request(req)
+	require.NoError(t, err)
+	assert.Equal(t, raw, string(got))
+
+	// Test: Binary bytes are escaped, text is kept
+	got, err = Request(req, WithHexEscape())
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(got), "\r\n\r\nab\\x00\\x01\\xffcdéf"))
+
+	// Test: Bodies are truncated with a note of what was left out
+	got, err = Request(req, WithBodyLimit(4), WithHexEscape())
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(got), "\r\n\r\nab\\x00\\x01\n[6 more bytes]\n"))
+
+	got, err = Request(req, WithBodyLimit(0))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(got), "\r\n\r\n\n[10 more bytes]\n"))
+}
+
+func TestRaw(t *testing.T) {
+	// Test: Interim responses are part of the head
+	raw := "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\nhello"
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\nhe\n[3 more bytes]\n",
+		string(Raw([]byte(raw), WithBodyLimit(2))))
+
+	// Test: Incomplete heads are returned unchanged
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", string(Raw([]byte("HTTP/1.1 200 OK\r\n"), WithBodyLimit(0))))
+}
+
+func TestRecorder(t *testing.T) {
+	var wire bytes.Buffer
+	rec := NewRecorder(&wire, WithBodyLimit(8))
+	w := response.NewWriter(rec)
+	h := response.GetDefaultHeaders(12)
+	require.NoError(t, w.WriteStatusLine(response.Ok))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.Write([]byte("hello, "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Test: Writes pass through untouched
+	assert.True(t, strings.HasSuffix(wire.String(), "\r\n\r\nhello, world"))
+
+	// Test: Only the head and the kept part of the body are held
+	head := strings.TrimSuffix(wire.String(), "hello, world")
+	assert.Equal(t, head+"hello, w", string(rec.Bytes()))
+	assert.Equal(t, head+"hello, w\n[4 more bytes]\n", string(rec.Dump()))
+
+	// Test: A head split across writes is found
+	rec = NewRecorder(nil, WithBodyLimit(1))
+	for _, part := range []string{"GET / HTTP/1.1\r\nhost: x\r", "\n\r", "\nab", "c"} {
+		_, err := rec.Write([]byte(part))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "GET / HTTP/1.1\r\nhost: x\r\n\r\na\n[2 more bytes]\n", string(rec.Dump()))
+}
@@ -0,0 +1,98 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+)
+
+const (
+	immutableCacheControl  = "public, max-age=31536000, immutable"
+	revalidateCacheControl = "no-cache"
+)
+
+// hashFiles computes a strong ETag from the SHA-256 of every regular file
+// in fsys. Files that can't be read are left out and fall back to the
+// modification time tag.
+func hashFiles(fsys fs.FS) map[string]string {
+	etags := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			log.Printf("error hashing %s: %v", name, err)
+			return nil
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			log.Printf("error hashing %s: %v", name, err)
+			return nil
+		}
+
+		etags[name] = `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:18]) + `"`
+		return nil
+	})
+	if err != nil {
+		log.Printf("error walking file system for ETags: %v", err)
+	}
+	return etags
+}
+
+// isFingerprinted reports whether a file name carries a content hash, as
+// bundlers produce for names like app.3f9a2c1b.js or index-BvK1e9Qx.css: a
+// segment after the first one, split on '.' and '-', of at least eight
+// characters that reads as hex or base64url output. Dates, version numbers
+// and words with digits in them, as in app-20240101.js or
+// report-2024_final.pdf, don't count.
+func isFingerprinted(name string) bool {
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	segments := strings.FieldsFunc(base, func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+
+	for _, segment := range segments[min(1, len(segments)):] {
+		if len(segment) >= 8 && isHashLike(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHashLike reports whether segment mixes digits with letters the way
+// hashes do: lowercase hex with at least one letter, or digits with both
+// upper and lower case letters.
+func isHashLike(segment string) bool {
+	var digit, hexLetter, lower, upper bool
+	for _, c := range segment {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'f':
+			hexLetter = true
+		case c >= 'g' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		default:
+			return false
+		}
+	}
+
+	if !digit {
+		return false
+	}
+	if !lower && !upper {
+		return hexLetter
+	}
+	return upper && (lower || hexLetter)
+}
@@ -0,0 +1,398 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/conditional"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/ranges"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+)
+
+const indexFile = "index.html"
+
+// FileServer serves the files of an fs.FS. Request paths are cleaned and
+// resolved inside the file system, so they can never reach outside it.
+// Directories are served through their index.html, or as a listing when
+// listings are enabled. Files get a Content-Type from their extension, or
+// from their content when the extension is unknown, and Last-Modified and
+// ETag validators for conditional and range requests.
+type FileServer struct {
+	fsys          fs.FS
+	listings      bool
+	precompressed bool
+	contentETags  bool
+	fingerprints  bool
+	spaFallback   bool
+
+	etags map[string]string
+}
+
+// Option configures a FileServer.
+type Option func(*FileServer)
+
+// WithListings makes directories without an index.html list their entries,
+// as JSON when the client accepts application/json and as HTML otherwise.
+func WithListings() Option {
+	return func(s *FileServer) {
+		s.listings = true
+	}
+}
+
+// WithPrecompressed serves a file's name.br or name.gz sibling, when it
+// exists and the client accepts that coding, in place of the file. The
+// response keeps the original file's Content-Type and gets a matching
+// Content-Encoding. Brotli is preferred when the client rates both
+// equally.
+func WithPrecompressed() Option {
+	return func(s *FileServer) {
+		s.precompressed = true
+	}
+}
+
+// WithContentETags hashes every file once, when the FileServer is created,
+// and uses the SHA-256 of its content as the ETag instead of one derived
+// from the modification time. It suits read-only trees such as an embed.FS,
+// whose files have no modification time.
+func WithContentETags() Option {
+	return func(s *FileServer) {
+		s.contentETags = true
+	}
+}
+
+// WithImmutableFingerprints lets clients cache files whose names carry a
+// content hash, such as app.3f9a2c1b.js, for a year without revalidating.
+// Every other file is sent with Cache-Control: no-cache.
+func WithImmutableFingerprints() Option {
+	return func(s *FileServer) {
+		s.fingerprints = true
+	}
+}
+
+// WithSPAFallback serves the root index.html for paths that don't exist,
+// so that the client side routes of a single page app load the app. Paths
+// with a file extension still get a 404, so a missing script or image isn't
+// answered with HTML.
+func WithSPAFallback() Option {
+	return func(s *FileServer) {
+		s.spaFallback = true
+	}
+}
+
+func New(fsys fs.FS, opts ...Option) *FileServer {
+	s := &FileServer{fsys: fsys}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.contentETags {
+		s.etags = hashFiles(fsys)
+	}
+	return s
+}
+
+// Handle implements server.Handler.
+func (s *FileServer) Handle(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		h := headers.NewHeaders()
+		h.Set("Allow", "GET, HEAD")
+		writeText(w, response.MethodNotAllowed, h, "Method not allowed\n")
+		return
+	}
+
+	urlPath, name, ok := resolve(req.RequestLine.RequestTarget)
+	if !ok {
+		writeText(w, response.BadRequest, nil, "Bad path\n")
+		return
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil && s.spaFallback && path.Ext(name) == "" {
+		name = indexFile
+		info, err = fs.Stat(s.fsys, name)
+	}
+
+	if err != nil {
+		writeText(w, response.NotFound, nil, "Not found\n")
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			// A relative target keeps working when the server is mounted
+			// under a prefix that was stripped before Handle.
+			location := (&url.URL{Path: "./" + path.Base(urlPath) + "/"}).EscapedPath()
+			if _, query, ok := strings.Cut(req.RequestLine.RequestTarget, "?"); ok {
+				location += "?" + query
+			}
+
+			h := headers.NewHeaders()
+			h.Set("Location", location)
+			writeText(w, response.MovedPermanently, h, "Moved permanently\n")
+			return
+		}
+
+		index := path.Join(name, indexFile)
+		if indexInfo, err := fs.Stat(s.fsys, index); err == nil && !indexInfo.IsDir() {
+			name, info = index, indexInfo
+		} else if s.listings {
+			s.serveListing(w, req, name)
+			return
+		} else {
+			writeText(w, response.NotFound, nil, "Not found\n")
+			return
+		}
+	}
+
+	if err := s.serveFile(w, req, name, info); err != nil {
+		log.Printf("error serving %s: %v", name, err)
+	}
+}
+
+// resolve splits the path from a request target, decodes it and cleans it
+// into a rooted URL path and the matching fs.FS name.
+func resolve(target string) (string, string, bool) {
+	rawPath, _, _ := strings.Cut(target, "?")
+	if !strings.HasPrefix(rawPath, "/") {
+		return "", "", false
+	}
+
+	decoded, err := url.PathUnescape(rawPath)
+	if err != nil || strings.ContainsAny(decoded, "\x00\\") {
+		return "", "", false
+	}
+
+	urlPath := path.Clean(decoded)
+	if urlPath != "/" && strings.HasSuffix(decoded, "/") {
+		urlPath += "/"
+	}
+
+	name := strings.Trim(urlPath, "/")
+	if name == "" {
+		name = "."
+	}
+
+	if !fs.ValidPath(name) {
+		return "", "", false
+	}
+	return urlPath, name, true
+}
+
+// precompressedSuffixes maps content codings to the file name suffix of
+// their precompressed siblings, in order of preference.
+var precompressedSuffixes = []struct{ coding, suffix string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func (s *FileServer) serveFile(w *response.Writer, req *request.Request, name string, info fs.FileInfo) error {
+	content, closeFile, err := s.open(name)
+	if err != nil {
+		writeText(w, response.NotFound, nil, "Not found\n")
+		return nil
+	}
+	defer closeFile()
+
+	contentType, err := contentType(name, content)
+	if err != nil {
+		return err
+	}
+
+	servedName := name
+	h := headers.NewHeaders()
+	h.Set("Content-Type", contentType)
+	if s.fingerprints {
+		if isFingerprinted(name) {
+			h.Set("Cache-Control", immutableCacheControl)
+		} else {
+			h.Set("Cache-Control", revalidateCacheControl)
+		}
+	}
+
+	if s.precompressed {
+		if coding, sibling, siblingInfo, ok := s.findPrecompressed(req, name, h); ok {
+			siblingContent, closeSibling, err := s.open(sibling)
+			if err == nil {
+				defer closeSibling()
+				h.Set("Content-Encoding", coding)
+				content, info, servedName = siblingContent, siblingInfo, sibling
+			}
+		}
+	}
+
+	v := conditional.Validators{
+		ETag:         fileETag(info),
+		LastModified: info.ModTime(),
+	}
+	if etag, ok := s.etags[servedName]; ok {
+		v.ETag = etag
+	}
+	return ranges.ServeContent(w, req, h, v, content)
+}
+
+// findPrecompressed looks for precompressed siblings of name and picks the
+// one the client rates highest. Vary is added to h whenever a sibling
+// exists, since the response then depends on Accept-Encoding.
+func (s *FileServer) findPrecompressed(req *request.Request, name string, h headers.Headers) (string, string, fs.FileInfo, bool) {
+	var available []string
+	infos := make(map[string]fs.FileInfo)
+	for _, p := range precompressedSuffixes {
+		info, err := fs.Stat(s.fsys, name+p.suffix)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		available = append(available, p.coding)
+		infos[p.coding] = info
+	}
+
+	if len(available) == 0 {
+		return "", "", nil, false
+	}
+	h.Set("Vary", "Accept-Encoding")
+
+	acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+	coding := headers.PreferredEncoding(acceptEncoding, available...)
+	for _, p := range precompressedSuffixes {
+		if p.coding == coding {
+			return coding, name + p.suffix, infos[coding], true
+		}
+	}
+	return "", "", nil, false
+}
+
+// open opens name for reading and seeking. Files that can't seek are read
+// into memory.
+func (s *FileServer) open(name string) (io.ReadSeeker, func() error, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if content, ok := f.(io.ReadSeeker); ok {
+		return content, f.Close, nil
+	}
+
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(data), func() error { return nil }, nil
+}
+
+// contentType picks the media type from the file extension, and sniffs the
+// start of content when the extension is unknown.
+func contentType(name string, content io.ReadSeeker) (string, error) {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return DetectContentType(buf[:n]), nil
+}
+
+// fileETag derives a strong entity tag from the size and modification time,
+// like most file servers do, so files don't have to be hashed.
+func fileETag(info fs.FileInfo) string {
+	if info.ModTime().IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+type listingEntry struct {
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func (s *FileServer) serveListing(w *response.Writer, req *request.Request, name string) {
+	dirEntries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		writeText(w, response.InternalServerError, nil, "Cannot read directory\n")
+		return
+	}
+
+	entries := make([]listingEntry, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, listingEntry{
+			Name:     entry.Name(),
+			Dir:      entry.IsDir(),
+			Size:     info.Size(),
+			Modified: info.ModTime().UTC(),
+		})
+	}
+
+	h := headers.NewHeaders()
+	w.WriteStatusLine(response.Ok)
+	accept, _ := req.Headers.Get("Accept")
+	if strings.Contains(accept, "application/json") {
+		h.Set("Content-Type", "application/json")
+		w.WriteHeaders(h)
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			log.Printf("error writing listing of %s: %v", name, err)
+		}
+		return
+	}
+
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeaders(h)
+
+	title := html.EscapeString("/" + strings.TrimPrefix(name, "."))
+	var b strings.Builder
+	fmt.Fprintf(&b, "<html>\n  <head>\n    <title>Index of %s</title>\n  </head>\n  <body>\n", title)
+	fmt.Fprintf(&b, "    <h1>Index of %s</h1>\n    <ul>\n", title)
+	for _, entry := range entries {
+		display := entry.Name
+		if entry.Dir {
+			display += "/"
+		}
+
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n",
+			html.EscapeString((&url.URL{Path: "./" + display}).EscapedPath()),
+			html.EscapeString(display))
+	}
+	b.WriteString("    </ul>\n  </body>\n</html>\n")
+	w.Write([]byte(b.String()))
+}
+
+func writeText(w *response.Writer, statusCode response.StatusCode, h headers.Headers, body string) {
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	h.Set("Content-Type", "text/plain")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+	w.Write([]byte(body))
+}
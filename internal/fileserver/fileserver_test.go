@@ -0,0 +1,268 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/middleware"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/mgmaster24/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var modified = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>home</h1>"), ModTime: modified},
+		"css/site.css":      {Data: []byte("body {}"), ModTime: modified},
+		"docs/README":       {Data: []byte("plain words"), ModTime: modified},
+		"docs/blob":         {Data: []byte{0x00, 0x01, 0x02}, ModTime: modified},
+		"docs/a b & c.txt":  {Data: []byte("spaced"), ModTime: modified},
+		"docs/nested/x.txt": {Data: []byte("x"), ModTime: modified},
+	}
+}
+
+func get(t *testing.T, s *FileServer, target string, fields ...string) (*response.Response, string) {
+	t.Helper()
+	return getWith(t, s.Handle, target, fields...)
+}
+
+func getWith(t *testing.T, handler server.Handler, target string, fields ...string) (*response.Response, string) {
+	t.Helper()
+	raw := "GET " + target + " HTTP/1.1\r\nHost: localhost\r\n"
+	for _, field := range fields {
+		raw += field + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetRequest(req)
+	w.EnableAutoFraming(response.DefaultFramingThreshold)
+	handler(w, req)
+	require.NoError(t, w.Close())
+
+	resp, err := response.ResponseFromReader(&buf)
+	require.NoError(t, err)
+	return resp, string(resp.Body)
+}
+
+func TestFileServer(t *testing.T) {
+	s := New(testFS())
+
+	// Test: The root serves index.html
+	resp, body := get(t, s, "/")
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "<h1>home</h1>", body)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Headers["content-type"])
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", resp.Headers["last-modified"])
+	etag := resp.Headers["etag"]
+	assert.NotEmpty(t, etag)
+
+	// Test: Conditional requests use the file validators
+	resp, _ = get(t, s, "/index.html", "If-None-Match: "+etag)
+	assert.Equal(t, response.NotModified, resp.ResponseLine.StatusCode)
+
+	// Test: Types come from the extension, then from the content
+	resp, _ = get(t, s, "/css/site.css?v=3")
+	assert.Equal(t, "text/css; charset=utf-8", resp.Headers["content-type"])
+	resp, _ = get(t, s, "/docs/README")
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Headers["content-type"])
+	resp, _ = get(t, s, "/docs/blob")
+	assert.Equal(t, "application/octet-stream", resp.Headers["content-type"])
+
+	// Test: Escaped names
+	_, body = get(t, s, "/docs/a%20b%20&%20c.txt")
+	assert.Equal(t, "spaced", body)
+
+	// Test: Traversal stays inside the file system
+	resp, body = get(t, s, "/../../docs/%2e%2e/css/site.css")
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "body {}", body)
+	resp, _ = get(t, s, "/docs/..%5c..%5cetc")
+	assert.Equal(t, response.BadRequest, resp.ResponseLine.StatusCode)
+
+	// Test: Directories redirect to their slash form
+	resp, _ = get(t, s, "/docs")
+	assert.Equal(t, response.MovedPermanently, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "./docs/", resp.Headers["location"])
+
+	// Test: Redirects are relative, escaped and keep the query, so they
+	// stay under a stripped mount prefix
+	fsys := testFS()
+	fsys["my dir%/x.txt"] = &fstest.MapFile{Data: []byte("x"), ModTime: modified}
+	resp, _ = get(t, New(fsys), "/my%20dir%25?sort=name")
+	assert.Equal(t, response.MovedPermanently, resp.ResponseLine.StatusCode)
+	location, err := url.Parse(resp.Headers["location"])
+	require.NoError(t, err)
+	mounted, err := url.Parse("http://localhost/static/my%20dir%25?sort=name")
+	require.NoError(t, err)
+	assert.Equal(t, "/static/my%20dir%25/?sort=name", mounted.ResolveReference(location).RequestURI())
+
+	// Test: Missing files and disabled listings
+	resp, _ = get(t, s, "/nope.txt")
+	assert.Equal(t, response.NotFound, resp.ResponseLine.StatusCode)
+	resp, _ = get(t, s, "/docs/")
+	assert.Equal(t, response.NotFound, resp.ResponseLine.StatusCode)
+
+	// Test: Ranges
+	resp, body = get(t, s, "/docs/README", "Range: bytes=0-4")
+	assert.Equal(t, response.PartialContent, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "plain", body)
+}
+
+func TestCompressedResume(t *testing.T) {
+	handler := middleware.Compress(1)(New(testFS()).Handle)
+
+	// Test: The gzipped response doesn't share the file's strong tag
+	resp, _ := getWith(t, handler, "/docs/README", "Accept-Encoding: gzip")
+	assert.Equal(t, "gzip", resp.Headers["content-encoding"])
+	etag := resp.Headers["etag"]
+	assert.True(t, strings.HasPrefix(etag, "W/"), etag)
+
+	// Test: Resuming against it sends the whole file instead of a range
+	resp, body := getWith(t, handler, "/docs/README", "Range: bytes=6-", "If-Range: "+etag)
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "plain words", body)
+
+	// Test: The identity tag still resumes
+	resp, body = getWith(t, handler, "/docs/README", "Range: bytes=6-", "If-Range: "+strings.TrimPrefix(etag, "W/"))
+	assert.Equal(t, response.PartialContent, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "words", body)
+}
+
+func TestListings(t *testing.T) {
+	s := New(testFS(), WithListings())
+
+	// Test: HTML listing
+	resp, body := get(t, s, "/docs/")
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Contains(t, body, `<a href="./a%20b%20&amp;%20c.txt">a b &amp; c.txt</a>`)
+	assert.Contains(t, body, `<a href="./nested/">nested/</a>`)
+
+	// Test: JSON listing
+	resp, body = get(t, s, "/docs/", "Accept: application/json")
+	assert.Equal(t, "application/json", resp.Headers["content-type"])
+	var entries []listingEntry
+	require.NoError(t, json.Unmarshal([]byte(body), &entries))
+	require.Len(t, entries, 4)
+	assert.Equal(t, "README", entries[0].Name)
+	assert.Equal(t, "nested", entries[3].Name)
+	assert.True(t, entries[3].Dir)
+}
+
+func TestDetectContentType(t *testing.T) {
+	assert.Equal(t, "image/png", DetectContentType([]byte("\x89PNG\r\n\x1a\n....")))
+	assert.Equal(t, "text/html; charset=utf-8", DetectContentType([]byte("\n  <!DOCTYPE html><html>")))
+	assert.Equal(t, "text/xml; charset=utf-8", DetectContentType([]byte("<?xml version=\"1.0\"?>")))
+	assert.Equal(t, "text/plain; charset=utf-8", DetectContentType([]byte("héllo\n")))
+	assert.Equal(t, "text/plain; charset=utf-8", DetectContentType([]byte("h\xc3")))
+	assert.Equal(t, "application/octet-stream", DetectContentType([]byte("\xff\xfe\x00")))
+}
+
+func TestPrecompressed(t *testing.T) {
+	fsys := testFS()
+	fsys["app.js"] = &fstest.MapFile{Data: []byte("console.log(1)"), ModTime: modified}
+	fsys["app.js.gz"] = &fstest.MapFile{Data: []byte("gzip bytes"), ModTime: modified}
+	fsys["app.js.br"] = &fstest.MapFile{Data: []byte("brotli bytes"), ModTime: modified}
+	fsys["only.css"] = &fstest.MapFile{Data: []byte("p {}"), ModTime: modified}
+	fsys["only.css.gz"] = &fstest.MapFile{Data: []byte("gzip css"), ModTime: modified}
+	s := New(fsys, WithPrecompressed())
+
+	// Test: Brotli is preferred when both are accepted
+	resp, body := get(t, s, "/app.js", "Accept-Encoding: gzip, br")
+	assert.Equal(t, "brotli bytes", body)
+	assert.Equal(t, "br", resp.Headers["content-encoding"])
+	assert.Equal(t, "Accept-Encoding", resp.Headers["vary"])
+	assert.Equal(t, "text/javascript; charset=utf-8", resp.Headers["content-type"])
+	brETag := resp.Headers["etag"]
+
+	// Test: The client's q-values win over the server preference
+	resp, body = get(t, s, "/app.js", "Accept-Encoding: gzip, br;q=0.5")
+	assert.Equal(t, "gzip bytes", body)
+	assert.Equal(t, "gzip", resp.Headers["content-encoding"])
+	assert.NotEqual(t, brETag, resp.Headers["etag"])
+
+	// Test: Revalidations keep Vary
+	resp, _ = get(t, s, "/app.js", "Accept-Encoding: gzip, br", "If-None-Match: "+brETag)
+	assert.Equal(t, response.NotModified, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "Accept-Encoding", resp.Headers["vary"])
+	assert.Equal(t, brETag, resp.Headers["etag"])
+
+	// Test: Clients that accept neither get the original with Vary
+	resp, body = get(t, s, "/app.js")
+	assert.Equal(t, "console.log(1)", body)
+	assert.Empty(t, resp.Headers["content-encoding"])
+	assert.Equal(t, "Accept-Encoding", resp.Headers["vary"])
+
+	resp, body = get(t, s, "/only.css", "Accept-Encoding: br, gzip")
+	assert.Equal(t, "gzip css", body)
+	assert.Equal(t, "text/css; charset=utf-8", resp.Headers["content-type"])
+
+	// Test: Files without siblings are served as they are
+	resp, _ = get(t, s, "/docs/README", "Accept-Encoding: gzip")
+	assert.Empty(t, resp.Headers["content-encoding"])
+	assert.Empty(t, resp.Headers["vary"])
+}
+
+func TestEmbeddedAssets(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":                {Data: []byte("<div id=app></div>")},
+		"assets/app.3f9a2c1b.js":    {Data: []byte("boot()")},
+		"assets/index-BvK1e9Qx.css": {Data: []byte("p {}")},
+		"assets/logo.svg":           {Data: []byte("<svg/>")},
+	}
+	s := New(fsys, WithContentETags(), WithImmutableFingerprints(), WithSPAFallback())
+
+	// Test: ETags come from the content when there is no modification time
+	resp, _ := get(t, s, "/assets/app.3f9a2c1b.js")
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	etag := resp.Headers["etag"]
+	assert.Equal(t, s.etags["assets/app.3f9a2c1b.js"], etag)
+	assert.Empty(t, resp.Headers["last-modified"])
+	assert.Equal(t, immutableCacheControl, resp.Headers["cache-control"])
+	resp, _ = get(t, s, "/assets/app.3f9a2c1b.js", "If-None-Match: "+etag)
+	assert.Equal(t, response.NotModified, resp.ResponseLine.StatusCode)
+	assert.Equal(t, immutableCacheControl, resp.Headers["cache-control"])
+
+	// Test: Revalidations keep the Cache-Control of the full response
+	resp, _ = get(t, s, "/settings/profile")
+	resp, _ = get(t, s, "/settings/profile", "If-None-Match: "+resp.Headers["etag"])
+	assert.Equal(t, response.NotModified, resp.ResponseLine.StatusCode)
+	assert.Equal(t, revalidateCacheControl, resp.Headers["cache-control"])
+
+	resp, _ = get(t, s, "/assets/index-BvK1e9Qx.css")
+	assert.Equal(t, immutableCacheControl, resp.Headers["cache-control"])
+	resp, _ = get(t, s, "/assets/logo.svg")
+	assert.Equal(t, revalidateCacheControl, resp.Headers["cache-control"])
+
+	// Test: Unknown routes load the app, unknown files don't
+	resp, body := get(t, s, "/settings/profile")
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "<div id=app></div>", body)
+	assert.Equal(t, revalidateCacheControl, resp.Headers["cache-control"])
+	resp, _ = get(t, s, "/assets/missing.js")
+	assert.Equal(t, response.NotFound, resp.ResponseLine.StatusCode)
+}
+
+func TestIsFingerprinted(t *testing.T) {
+	for _, name := range []string{"app.3f9a2c1b.js", "a/index-BvK1e9Qx.css", "chunk.1234abcd.min.js", "font.0123456789ab.woff2", "main.a1b2c3d4e5f60718.js"} {
+		assert.True(t, isFingerprinted(name), name)
+	}
+
+	for _, name := range []string{
+		"app.js", "3f9a2c1b.js", "components.js", "jquery-3.7.1.min.js", "my-component.js",
+		"app-20240101.js", "report-2024_final.pdf", "notes-q4summary2024.txt", "build.12345678.js",
+	} {
+		assert.False(t, isFingerprinted(name), name)
+	}
+}
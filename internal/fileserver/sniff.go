@@ -0,0 +1,93 @@
+package fileserver
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a file DetectContentType looks at.
+const sniffLen = 512
+
+type signature struct {
+	prefix      []byte
+	contentType string
+}
+
+var signatures = []signature{
+	{[]byte("%PDF-"), "application/pdf"},
+	{[]byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{[]byte("\xff\xd8\xff"), "image/jpeg"},
+	{[]byte("GIF87a"), "image/gif"},
+	{[]byte("GIF89a"), "image/gif"},
+	{[]byte("PK\x03\x04"), "application/zip"},
+	{[]byte("\x1f\x8b\x08"), "application/gzip"},
+	{[]byte("wOFF"), "font/woff"},
+	{[]byte("wOF2"), "font/woff2"},
+	{[]byte("\x00asm"), "application/wasm"},
+	{[]byte("%!PS-Adobe-"), "application/postscript"},
+}
+
+// htmlTags are the openings that mark a document as HTML once leading
+// whitespace is skipped, compared case insensitively.
+var htmlTags = [][]byte{
+	[]byte("<!doctype html"),
+	[]byte("<html"),
+	[]byte("<head"),
+	[]byte("<body"),
+	[]byte("<script"),
+	[]byte("<!--"),
+}
+
+// DetectContentType guesses the media type of data from its first bytes,
+// for files whose extension doesn't name one. It recognises common binary
+// formats by their magic numbers and HTML and XML by their opening tag, and
+// otherwise tells text from binary by whether data is valid UTF-8 without
+// control characters.
+func DetectContentType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+
+	for _, sig := range signatures {
+		if bytes.HasPrefix(data, sig.prefix) {
+			return sig.contentType
+		}
+	}
+
+	if len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")) {
+		return "image/webp"
+	}
+
+	text := bytes.TrimLeft(data, " \t\r\n")
+	lower := bytes.ToLower(text[:min(len(text), 16)])
+	for _, tag := range htmlTags {
+		if bytes.HasPrefix(lower, tag) {
+			return "text/html; charset=utf-8"
+		}
+	}
+
+	if bytes.HasPrefix(lower, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+func isText(data []byte) bool {
+	// A multi-byte rune may be cut off at the end of the sniffed bytes.
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return len(data) < utf8.UTFMax && !utf8.FullRune(data)
+		}
+
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
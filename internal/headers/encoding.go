@@ -0,0 +1,54 @@
+package headers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PreferredEncoding picks the content coding an Accept-Encoding value
+// rates highest among supported, which is listed in the server's order of
+// preference and breaks ties. A "*" entry covers codings the value doesn't
+// name, and q=0 rules a coding out. It returns "" when nothing in
+// supported is acceptable.
+func PreferredEncoding(acceptEncoding string, supported ...string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, member := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(member, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		if coding == "*" {
+			wildcard = q
+			continue
+		}
+		weights[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range supported {
+		q, ok := weights[coding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
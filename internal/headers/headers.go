@@ -42,15 +42,37 @@ func (h Headers) Parse(data []byte) (int, bool, error) {
 	return crlfIdx + len(crlf), false, nil
 }
 
+// lineSeparator joins the values of fields that can't be combined into one
+// comma-separated line. Field values never contain a line feed.
+const lineSeparator = "\n"
+
+// Set adds value to key. Repeated fields are combined with ", ", except
+// Set-Cookie, whose values may contain commas; its lines are kept apart
+// and written out one by one.
 func (h Headers) Set(key string, value string) {
 	key = strings.ToLower(key)
 	if val, ok := h[key]; ok {
-		value = strings.Join([]string{val, value}, ", ")
+		separator := ", "
+		if key == "set-cookie" {
+			separator = lineSeparator
+		}
+		value = val + separator + value
 	}
 
 	h[key] = value
 }
 
+// Values returns the field lines to write for key: one per Set-Cookie
+// value and a single line for any other field.
+func (h Headers) Values(key string) []string {
+	val, ok := h[strings.ToLower(key)]
+	if !ok {
+		return nil
+	}
+
+	return strings.Split(val, lineSeparator)
+}
+
 func (h Headers) Get(key string) (string, bool) {
 	key = strings.ToLower(key)
 	if val, ok := h[key]; ok {
@@ -60,6 +82,15 @@ func (h Headers) Get(key string) (string, bool) {
 	return "", false
 }
 
+// Replace sets key to value, dropping any values it already had.
+func (h Headers) Replace(key string, value string) {
+	h[strings.ToLower(key)] = value
+}
+
+func (h Headers) Delete(key string) {
+	delete(h, strings.ToLower(key))
+}
+
 func isValidString(s string) bool {
 	specialChars := "!#$%&'*+-./^_`|~"
 	for _, char := range s {
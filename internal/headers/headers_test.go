@@ -2,6 +2,7 @@ package headers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -102,4 +103,97 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, "lane-loves-go, prime-loves-zig, moose-loves-rust", headers["set-person"])
 	assert.Equal(t, 30, n)
 	assert.False(t, done)
+
+	// Test: Set-Cookie lines stay apart, commas and all
+	headers = NewHeaders()
+	data = []byte("Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: b=2\r\n\r\n")
+	n, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, headers.Values("Set-Cookie"))
+	headers.Set("Vary", "Accept")
+	headers.Set("Vary", "Accept-Encoding")
+	assert.Equal(t, []string{"Accept, Accept-Encoding"}, headers.Values("Vary"))
+	assert.Nil(t, headers.Values("Link"))
+}
+
+func TestPreferredEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", PreferredEncoding("gzip, deflate", "gzip", "deflate"))
+	assert.Equal(t, "deflate", PreferredEncoding("gzip;q=0.5, deflate", "gzip", "deflate"))
+	assert.Equal(t, "deflate", PreferredEncoding("*;q=0.3, gzip;q=0", "gzip", "deflate"))
+	assert.Equal(t, "", PreferredEncoding("br, identity", "gzip", "deflate"))
+	assert.Equal(t, "", PreferredEncoding("", "gzip", "deflate"))
+	assert.Equal(t, "gzip", PreferredEncoding("GZIP ; Q=1", "gzip", "deflate"))
+}
+
+func TestHTTPDates(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+
+	// Test: All three HTTP-date formats
+	for _, value := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseHTTPDate(value)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+
+	// Test: RFC 850 years are at most 50 years ahead
+	now := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	for value, year := range map[string]int{
+		"Thursday, 01-Jan-70 00:00:00 GMT": 2070,
+		"Friday, 01-Jan-76 00:00:00 GMT":   2076,
+		"Saturday, 01-Jan-77 00:00:00 GMT": 1977,
+		"Sunday, 06-Nov-94 08:49:37 GMT":   1994,
+		"Monday, 01-Jan-01 00:00:00 GMT":   2001,
+	} {
+		got, err := parseHTTPDate(value, now)
+		require.NoError(t, err, value)
+		assert.Equal(t, year, got.Year(), value)
+	}
+
+	// Test: Invalid dates
+	_, err := ParseHTTPDate("yesterday")
+	require.Error(t, err)
+
+	// Test: Typed accessors
+	h := NewHeaders()
+	h.SetTime("Last-Modified", want.In(time.FixedZone("EST", -5*3600)))
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", h["last-modified"])
+	got, ok := h.GetTime("Last-Modified")
+	assert.True(t, ok)
+	assert.True(t, want.Equal(got))
+
+	h.Set("Expires", "0")
+	_, ok = h.GetTime("Expires")
+	assert.False(t, ok)
+
+	h.Set("Retry-After", "120")
+	retry, ok := h.RetryAfter(want)
+	assert.True(t, ok)
+	assert.True(t, want.Add(2*time.Minute).Equal(retry))
+}
+
+func TestIntFields(t *testing.T) {
+	h := NewHeaders()
+	_, ok := h.ContentLength()
+	assert.False(t, ok)
+
+	h.Set("Content-Length", "1024")
+	h.Set("Age", "60")
+	n, ok := h.ContentLength()
+	assert.True(t, ok)
+	assert.Equal(t, int64(1024), n)
+	age, ok := h.Age()
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, age)
+
+	for _, bad := range []string{"-1", "+5", "1e3", "12, 12", ""} {
+		h.Replace("Content-Length", bad)
+		_, ok = h.ContentLength()
+		assert.False(t, ok, bad)
+	}
 }
@@ -0,0 +1,119 @@
+package headers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the IMF-fixdate layout, the HTTP-date format senders must
+// use.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// Obsolete HTTP-date layouts that recipients must still accept.
+const (
+	rfc850Format  = "Monday, 02-Jan-06 15:04:05 GMT"
+	asctimeFormat = "Mon Jan _2 15:04:05 2006"
+)
+
+// FormatHTTPDate formats t as an IMF-fixdate in GMT.
+func FormatHTTPDate(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// ParseHTTPDate parses an HTTP-date in any of the three formats RFC 9110
+// allows: IMF-fixdate, the obsolete RFC 850 format and asctime. An RFC 850
+// two digit year is taken to be in the current century unless that puts it
+// more than 50 years in the future, in which case it is in the previous
+// one (RFC 9110 §5.6.7).
+func ParseHTTPDate(value string) (time.Time, error) {
+	return parseHTTPDate(value, time.Now())
+}
+
+func parseHTTPDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(TimeFormat, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(rfc850Format, value); err == nil {
+		// time.Parse maps two digit years to 1969-2068; apply the RFC's
+		// rule relative to now instead.
+		year := now.UTC().Year() - now.UTC().Year()%100 + t.Year()%100
+		if year > now.UTC().Year()+50 {
+			year -= 100
+		}
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+	}
+
+	if t, err := time.Parse(asctimeFormat, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid HTTP-date: %s", value)
+}
+
+// GetTime returns the HTTP-date in key, such as If-Modified-Since,
+// Last-Modified or Expires. It reports false when the field is missing or
+// isn't a valid date; RFC 9110 has recipients ignore invalid dates.
+func (h Headers) GetTime(key string) (time.Time, bool) {
+	value, ok := h.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := ParseHTTPDate(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// SetTime sets key to t as an IMF-fixdate, replacing any previous value.
+func (h Headers) SetTime(key string, t time.Time) {
+	h.Replace(key, FormatHTTPDate(t))
+}
+
+// GetInt returns the non-negative decimal integer in key. It reports false
+// when the field is missing or holds anything other than digits.
+func (h Headers) GetInt(key string) (int64, bool) {
+	value, ok := h.Get(key)
+	if !ok {
+		return 0, false
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// ContentLength returns the Content-Length field.
+func (h Headers) ContentLength() (int64, bool) {
+	return h.GetInt("Content-Length")
+}
+
+// Age returns the Age field, the time a response has spent in caches.
+func (h Headers) Age() (time.Duration, bool) {
+	seconds, ok := h.GetInt("Age")
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// RetryAfter returns the time the Retry-After field asks clients to wait
+// until, taking a delay in seconds relative to now.
+func (h Headers) RetryAfter(now time.Time) (time.Time, bool) {
+	if seconds, ok := h.GetInt("Retry-After"); ok {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	return h.GetTime("Retry-After")
+}
@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/mgmaster24/httpfromtcp/internal/server"
+)
+
+// DefaultCompressMinSize is the body size below which compressing isn't
+// worth the gzip framing overhead.
+const DefaultCompressMinSize = 1024
+
+// incompressibleTypes are media types whose content is already compressed.
+var incompressibleTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/octet-stream":     true,
+	"application/pdf":              true,
+	"application/vnd.rar":          true,
+	"application/x-7z-compressed":  true,
+	"application/x-bzip2":          true,
+	"application/x-gzip":           true,
+	"application/x-rar-compressed": true,
+	"application/x-xz":             true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+// Compress compresses response bodies with gzip or deflate, whichever the
+// request's Accept-Encoding rates higher, preferring gzip on a tie.
+// Bodies that already have a Content-Encoding, are of an already
+// compressed media type, or are shorter than minSize are sent as they
+// are. Compressible responses get Vary: Accept-Encoding either way, and a
+// strong ETag on a compressed response is made weak. The compressed length
+// isn't known up front, so compressed bodies are streamed with chunked
+// encoding unless auto framing holds all of it.
+func Compress(minSize int) func(server.Handler) server.Handler {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+			w.AddFilter(&compressFilter{
+				request:  req,
+				encoding: headers.PreferredEncoding(acceptEncoding, "gzip", "deflate"),
+				minSize:  minSize,
+			})
+			next(w, req)
+		}
+	}
+}
+
+type compressMode int
+
+const (
+	undecided   compressMode = 0
+	compressing compressMode = 1
+	passthrough compressMode = 2
+)
+
+type compressFilter struct {
+	request  *request.Request
+	encoding string
+	minSize  int
+
+	checked    bool
+	compatible bool
+	mode       compressMode
+	held       bytes.Buffer
+	dst        io.Writer
+	zw         io.WriteCloser
+}
+
+// compressible reports whether the response is a candidate for compression
+// at all, regardless of what the client accepts.
+func (f *compressFilter) compressible(head *response.Head) bool {
+	if f.checked {
+		return f.compatible
+	}
+	f.checked = true
+
+	switch head.StatusCode {
+	case response.NoContent, response.NotModified, response.PartialContent:
+		return false
+	}
+
+	if _, ok := head.Headers.Get("Content-Range"); ok {
+		return false
+	}
+
+	if ce, ok := head.Headers.Get("Content-Encoding"); ok && !strings.EqualFold(ce, "identity") {
+		return false
+	}
+
+	contentType, ok := head.Headers.Get("Content-Type")
+	if !ok {
+		return false
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if strings.HasPrefix(mediaType, "image/") {
+		f.compatible = mediaType == "image/svg+xml"
+		return f.compatible
+	}
+
+	f.compatible = !strings.HasPrefix(mediaType, "video/") &&
+		!strings.HasPrefix(mediaType, "audio/") &&
+		!incompressibleTypes[mediaType]
+	return f.compatible
+}
+
+func (f *compressFilter) Header(head *response.Head) {
+	if !f.compressible(head) {
+		f.mode = passthrough
+		return
+	}
+
+	if vary, ok := head.Headers.Get("Vary"); !ok || !strings.Contains(strings.ToLower(vary), "accept-encoding") {
+		head.Headers.Set("Vary", "Accept-Encoding")
+	}
+
+	if f.encoding == "" {
+		f.mode = passthrough
+		return
+	}
+
+	// Headers committed before any body was written: decide from the
+	// declared framing.
+	if f.mode == undecided {
+		f.mode = passthrough
+		if n, ok := head.Headers.ContentLength(); ok {
+			if n >= int64(f.minSize) {
+				f.mode = compressing
+			}
+		} else if head.Chunked() {
+			f.mode = compressing
+		}
+	}
+
+	if f.mode != compressing {
+		return
+	}
+
+	head.Headers.Replace("Content-Encoding", f.encoding)
+	// The compressed bytes differ from the ones a strong tag promises.
+	if etag, ok := head.Headers.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+		head.Headers.Replace("ETag", "W/"+etag)
+	}
+	if head.Body == nil {
+		head.Headers.Delete("Content-Length")
+		if f.request.RequestLine.HttpVersion == "1.0" {
+			head.Headers.Replace("Connection", "close")
+		} else if !head.Chunked() {
+			head.Headers.Replace("Transfer-Encoding", "chunked")
+		}
+	}
+}
+
+func (f *compressFilter) Reset() {
+	f.checked = false
+	f.compatible = false
+	f.mode = undecided
+	f.held.Reset()
+	f.dst = nil
+	f.zw = nil
+}
+
+func (f *compressFilter) Body(dst io.Writer, head *response.Head) io.WriteCloser {
+	f.dst = dst
+	if f.encoding == "" || !f.compressible(head) {
+		f.mode = passthrough
+	}
+
+	if f.mode == compressing {
+		f.startCompressing()
+	}
+	return f
+}
+
+func (f *compressFilter) startCompressing() {
+	f.mode = compressing
+	if f.encoding == "gzip" {
+		f.zw = gzip.NewWriter(f.dst)
+	} else {
+		f.zw, _ = zlib.NewWriterLevel(f.dst, zlib.DefaultCompression)
+	}
+}
+
+// Write holds back the start of a body whose size isn't known until it
+// reaches minSize, so that short bodies go out uncompressed.
+func (f *compressFilter) Write(p []byte) (int, error) {
+	switch f.mode {
+	case compressing:
+		return f.zw.Write(p)
+	case passthrough:
+		return f.dst.Write(p)
+	}
+
+	f.held.Write(p)
+	if f.held.Len() < f.minSize {
+		return len(p), nil
+	}
+
+	f.startCompressing()
+	if _, err := f.zw.Write(f.held.Bytes()); err != nil {
+		return 0, err
+	}
+	f.held.Reset()
+	return len(p), nil
+}
+
+func (f *compressFilter) Close() error {
+	switch f.mode {
+	case compressing:
+		return f.zw.Close()
+	case undecided:
+		f.mode = passthrough
+		_, err := f.dst.Write(f.held.Bytes())
+		return err
+	}
+	return nil
+}
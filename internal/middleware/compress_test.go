@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("compress me please ", 20)
+	textHandler := func(contentType string, framing bool) func(*response.Writer, *request.Request) {
+		return func(w *response.Writer, req *request.Request) {
+			h := headers.NewHeaders()
+			h.Set("Content-Type", contentType)
+			if framing {
+				h.Set("Content-Length", "380")
+				h.Set("ETag", `"v1"`)
+			}
+			w.WriteStatusLine(response.Ok)
+			w.WriteHeaders(h)
+			w.Write([]byte(body[:190]))
+			w.Write([]byte(body[190:]))
+		}
+	}
+	parse := func(out string) *response.Response {
+		resp, err := response.ResponseFromReader(strings.NewReader(out))
+		require.NoError(t, err)
+		return resp
+	}
+
+	// Test: A streamed body is gzipped and chunked
+	handler := Compress(100)(textHandler("text/html", false))
+	out := serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip, deflate\r\n\r\n")
+	resp := parse(out)
+	assert.Equal(t, "gzip", resp.Headers["content-encoding"])
+	assert.Equal(t, "Accept-Encoding", resp.Headers["vary"])
+	assert.Equal(t, "chunked", resp.Headers["transfer-encoding"])
+	zr, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: A declared Content-Length is replaced by chunked framing
+	handler = Compress(100)(textHandler("application/json", true))
+	out = serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip;q=0.5, deflate\r\n\r\n")
+	assert.NotContains(t, out, "content-length")
+	resp = parse(out)
+	assert.Equal(t, "deflate", resp.Headers["content-encoding"])
+	assert.Equal(t, `W/"v1"`, resp.Headers["etag"])
+	assert.Equal(t, "chunked", resp.Headers["transfer-encoding"])
+	zr2, err := zlib.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(zr2)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: Bodies below the minimum size are sent as they are
+	handler = Compress(1000)(textHandler("text/html", false))
+	out = serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.NotContains(t, out, "content-encoding")
+	assert.Contains(t, out, "vary: Accept-Encoding\r\n")
+	assert.Equal(t, body, string(parse(out).Body))
+
+	// Test: Already compressed media types are left alone
+	handler = Compress(100)(textHandler("image/png", false))
+	out = serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.NotContains(t, out, "content-encoding")
+	assert.NotContains(t, out, "vary")
+
+	// Test: A client that accepts no supported coding gets identity
+	handler = Compress(100)(textHandler("text/html", false))
+	out = serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: br, gzip;q=0\r\n\r\n")
+	assert.NotContains(t, out, "content-encoding")
+	assert.Contains(t, out, "vary: Accept-Encoding\r\n")
+	assert.Equal(t, body, string(parse(out).Body))
+}
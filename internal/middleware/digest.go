@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"hash"
+	"io"
+
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/mgmaster24/httpfromtcp/internal/server"
+)
+
+// ContentDigest adds an RFC 9530 Content-Digest to every response,
+// hashing the body incrementally as the handler writes it. A body that
+// auto framing holds in full gets the digest as a header; a streamed
+// chunked body gets it as a trailer. Close delimited bodies and responses
+// without a body get none. With no algorithms it uses SHA-256. A client
+// that sends Want-Content-Digest gets the configured algorithms it asks for.
+func ContentDigest(algs ...digest.Algorithm) func(server.Handler) server.Handler {
+	if len(algs) == 0 {
+		algs = []digest.Algorithm{digest.SHA256}
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.RequestLine.Method != "HEAD" {
+				chosen := algs
+				if want, ok := req.Headers.Get("Want-Content-Digest"); ok {
+					chosen = digest.Negotiate(want, algs)
+				}
+				w.AddFilter(newDigestFilter(chosen))
+			}
+			next(w, req)
+		}
+	}
+}
+
+type digestFilter struct {
+	algs     []digest.Algorithm
+	hashes   []hash.Hash
+	trailers bool
+}
+
+func newDigestFilter(algs []digest.Algorithm) *digestFilter {
+	f := &digestFilter{}
+	for _, alg := range algs {
+		if h := alg.New(); h != nil {
+			f.algs = append(f.algs, alg)
+			f.hashes = append(f.hashes, h)
+		}
+	}
+	return f
+}
+
+func (f *digestFilter) Header(head *response.Head) {
+	if len(f.algs) == 0 || head.StatusCode == response.NoContent ||
+		head.StatusCode == response.NotModified {
+		return
+	}
+
+	if head.Body != nil {
+		head.Headers.Replace("Content-Digest", f.value())
+		return
+	}
+
+	if head.Chunked() {
+		f.trailers = true
+		head.Headers.Set("Trailer", "Content-Digest")
+	}
+}
+
+func (f *digestFilter) Reset() {
+	for _, h := range f.hashes {
+		h.Reset()
+	}
+	f.trailers = false
+}
+
+func (f *digestFilter) Body(dst io.Writer, head *response.Head) io.WriteCloser {
+	writers := []io.Writer{dst}
+	for _, h := range f.hashes {
+		writers = append(writers, h)
+	}
+	return nopCloser{io.MultiWriter(writers...)}
+}
+
+func (f *digestFilter) Trailers(h headers.Headers) {
+	if f.trailers {
+		h.Replace("Content-Digest", f.value())
+	}
+}
+
+func (f *digestFilter) value() string {
+	sums := make([][]byte, len(f.hashes))
+	for i, h := range f.hashes {
+		sums[i] = h.Sum(nil)
+	}
+	return digest.Format(f.algs, sums)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, handler func(*response.Writer, *request.Request), raw string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetRequest(req)
+	w.EnableAutoFraming(16)
+	handler(w, req)
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestContentDigest(t *testing.T) {
+	sha256Of := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	// Test: A buffered body gets the digest as a header
+	handler := ContentDigest()(func(w *response.Writer, req *request.Request) {
+		w.Write([]byte("hello world"))
+	})
+	out := serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "content-digest: sha-256=:"+sha256Of("hello world")+":\r\n")
+	assert.Contains(t, out, "content-length: 11\r\n")
+
+	// Test: A streamed body gets the digest as a trailer
+	body := strings.Repeat("a", 40)
+	handler = ContentDigest(digest.SHA256, digest.SHA512)(
+		func(w *response.Writer, req *request.Request) {
+			for i := 0; i < 4; i++ {
+				w.Write([]byte(body[i*10 : (i+1)*10]))
+			}
+		},
+	)
+	out = serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nTE: trailers\r\n\r\n")
+	sum512 := sha512.Sum512([]byte(body))
+	assert.Contains(t, out, "transfer-encoding: chunked\r\n")
+	assert.Contains(t, out, "trailer: content-digest\r\n")
+	assert.True(t, strings.HasSuffix(out, "0\r\ncontent-digest: "+
+		"sha-256=:"+sha256Of(body)+":, "+
+		"sha-512=:"+base64.StdEncoding.EncodeToString(sum512[:])+":\r\n\r\n"))
+
+	// Test: Explicit chunks with handler trailers
+	handler = ContentDigest()(func(w *response.Writer, req *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.Ok)
+		w.DeclareTrailer("X-Count")
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hello "))
+		w.WriteChunkedBody([]byte("world"))
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Count", "2")
+		w.WriteTrailers(trailers)
+	})
+	out = serve(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\nTE: trailers\r\n\r\n")
+	assert.Contains(t, out, "content-digest: sha-256=:"+sha256Of("hello world")+":\r\n")
+	assert.Contains(t, out, "x-count: 2\r\n")
+
+	// Test: Want-Content-Digest picks among the configured algorithms
+	out = serve(t, ContentDigest(digest.SHA256, digest.SHA512)(
+		func(w *response.Writer, req *request.Request) {
+			w.Write([]byte(body))
+		},
+	), "GET / HTTP/1.1\r\nHost: localhost\r\nTE: trailers\r\nWant-Content-Digest: sha-512=3, md5=10\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "0\r\ncontent-digest: sha-512=:"+
+		base64.StdEncoding.EncodeToString(sum512[:])+":\r\n\r\n"))
+
+	// Test: HEAD responses carry no digest
+	out = serve(t, ContentDigest()(func(w *response.Writer, req *request.Request) {
+		w.Write([]byte("hello world"))
+	}), "HEAD / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.NotContains(t, out, "content-digest")
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/mgmaster24/httpfromtcp/internal/conditional"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/mgmaster24/httpfromtcp/internal/server"
+)
+
+// ETag gives 200 responses to GET and HEAD a strong ETag computed from a
+// SHA-256 of the body, and answers requests whose If-None-Match or
+// If-Modified-Since matches with 304 Not Modified. Only bodies that auto
+// framing holds in full, up to its threshold, can be hashed; streamed and
+// chunked responses are left alone unless the handler set an ETag or
+// Last-Modified itself, which are then used as the validators.
+//
+// The hash covers the body as sent, so each content coding gets its own
+// tag. ETag should be the innermost of the middleware so that a switch to
+// 304 happens before Compress or ContentDigest add their fields.
+func ETag() func(server.Handler) server.Handler {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD" {
+				w.AddFilter(etagFilter{request: req})
+			}
+			next(w, req)
+		}
+	}
+}
+
+type etagFilter struct {
+	request *request.Request
+}
+
+func (f etagFilter) Header(head *response.Head) {
+	if head.StatusCode != response.Ok {
+		return
+	}
+
+	var v conditional.Validators
+	v.LastModified, _ = head.Headers.GetTime("Last-Modified")
+	if etag, ok := head.Headers.Get("ETag"); ok {
+		v.ETag = etag
+	} else if head.Body != nil {
+		sum := sha256.Sum256(head.Body)
+		v.ETag = `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+		head.Headers.Set("ETag", v.ETag)
+	}
+
+	if v.ETag == "" && v.LastModified.IsZero() {
+		return
+	}
+
+	if conditional.Evaluate(f.request, v) == response.NotModified {
+		head.StatusCode = response.NotModified
+	}
+}
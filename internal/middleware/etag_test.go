@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	small := ETag()(func(w *response.Writer, req *request.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	// Test: A buffered body gets a strong ETag
+	out := serve(t, small, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	idx := strings.Index(out, "etag: \"")
+	require.NotEqual(t, -1, idx)
+	etag := out[idx+len("etag: ") : idx+strings.Index(out[idx:], "\r\n")]
+
+	// Test: A matching If-None-Match gets 304 without a body
+	out = serve(t, small, "GET / HTTP/1.1\r\nHost: localhost\r\nIf-None-Match: "+etag+"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, out, "etag: "+etag+"\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: A different tag gets the full body
+	out = serve(t, small, "GET / HTTP/1.1\r\nHost: localhost\r\nIf-None-Match: \"other\"\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nhello"))
+
+	// Test: Streamed bodies are left alone
+	streamed := ETag()(func(w *response.Writer, req *request.Request) {
+		w.Write([]byte(strings.Repeat("a", 40)))
+	})
+	out = serve(t, streamed, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.NotContains(t, out, "etag")
+
+	// Test: A streamed body with a handler validator can still get 304
+	validated := ETag()(func(w *response.Writer, req *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("ETag", `W/"v1"`)
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(h)
+		w.Write([]byte(strings.Repeat("a", 40)))
+	})
+	out = serve(t, validated, "GET / HTTP/1.1\r\nHost: localhost\r\nIf-None-Match: \"v1\"\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.NotContains(t, out, "aaaa")
+	assert.NotContains(t, out, "transfer-encoding")
+}
@@ -0,0 +1,277 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/client"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+)
+
+// DefaultTimeout bounds how long the proxy waits to connect to the
+// upstream and for its response headers.
+const DefaultTimeout = 30 * time.Second
+
+// hopByHopHeaders apply to a single connection and are never forwarded.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy forwards requests to an upstream server and streams its responses
+// back. The request target is appended to the upstream URL's path.
+type Proxy struct {
+	target  *url.URL
+	timeout time.Duration
+	via     string
+	client  *client.Client
+}
+
+// Option configures a Proxy.
+type Option func(*Proxy)
+
+// WithTimeout sets how long to wait for the upstream to accept the
+// connection and to send its response headers. Bodies may stream for
+// longer.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Proxy) {
+		p.timeout = timeout
+	}
+}
+
+// WithVia sets the pseudonym the proxy adds to Via headers.
+func WithVia(pseudonym string) Option {
+	return func(p *Proxy) {
+		p.via = pseudonym
+	}
+}
+
+func New(target string, opts ...Option) (*Proxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL: %s", target)
+	}
+
+	p := &Proxy{
+		target:  u,
+		timeout: DefaultTimeout,
+		via:     "httpfromtcp",
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.client = &client.Client{Timeout: p.timeout, Transport: &client.Transport{}}
+	return p, nil
+}
+
+// Handle implements server.Handler. The request body is streamed upstream
+// as it arrives, with the server's WithStreamingBodies; otherwise it has
+// already been read. Upstream failures before the response headers are
+// answered with 504 Gateway Timeout when the upstream was too slow and 502
+// Bad Gateway otherwise. A failure while the body streams is answered with
+// 502 Bad Gateway as long as none of the response has been sent, and
+// otherwise aborts it, leaving it visibly truncated.
+func (p *Proxy) Handle(w *response.Writer, req *request.Request) {
+	target, err := p.upstreamURL(req.RequestLine.RequestTarget)
+	if err != nil {
+		log.Printf("proxy: invalid request target: %v", err)
+		writeError(w, response.BadRequest)
+		return
+	}
+
+	outReq, err := client.NewRequest(req.RequestLine.Method, target, nil)
+	if err != nil {
+		log.Printf("proxy: error building upstream request: %v", err)
+		writeError(w, response.BadRequest)
+		return
+	}
+
+	p.forwardBody(req, outReq)
+	p.forwardRequestHeaders(req, outReq.Headers)
+	resp, err := p.client.Do(outReq)
+	if err != nil {
+		log.Printf("proxy: upstream request failed: %v", err)
+		if errors.Is(err, client.ErrRequestBody) {
+			writeError(w, response.BadRequest)
+		} else if isTimeout(err) {
+			writeError(w, response.GatewayTimeout)
+		} else {
+			writeError(w, response.BadGateway)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	h := headers.NewHeaders()
+	for name, value := range resp.Headers {
+		h.Set(name, value)
+	}
+
+	if _, chunked := h.Get("Transfer-Encoding"); chunked {
+		h.Delete("Content-Length")
+	}
+
+	declared := make(map[string]bool)
+	if trailer, ok := h.Get("Trailer"); ok {
+		for _, name := range strings.Split(trailer, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if w.DeclareTrailer(name) == nil {
+				declared[name] = true
+			}
+		}
+	}
+
+	removeHopByHop(h)
+	h.Set("Via", resp.HttpVersion+" "+p.via)
+
+	w.WriteStatusLine(resp.StatusCode)
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("proxy: error writing headers: %v", err)
+		w.Abort()
+		return
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("proxy: error streaming upstream body: %v", err)
+		// While auto framing still holds the head the client can be told
+		// properly; after that all that's left is to cut the body short.
+		if w.Reset() == nil {
+			writeError(w, response.BadGateway)
+		} else {
+			w.Abort()
+		}
+		return
+	}
+
+	trailers := headers.NewHeaders()
+	for name, value := range resp.Trailers {
+		if declared[name] {
+			trailers.Set(name, value)
+		}
+	}
+
+	if len(trailers) == 0 {
+		return
+	}
+
+	if err := w.WriteTrailers(trailers); err != nil {
+		log.Printf("proxy: error writing trailers: %v", err)
+	}
+}
+
+// upstreamURL appends target to the upstream URL. The path is joined in its
+// escaped form so that escapes such as %2F reach the upstream unchanged.
+func (p *Proxy) upstreamURL(target string) (string, error) {
+	u := *p.target
+	rawPath, query, _ := strings.Cut(target, "?")
+	escaped := strings.TrimSuffix(p.target.EscapedPath(), "/") + rawPath
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = path
+	u.RawPath = escaped
+	u.RawQuery = query
+	return u.String(), nil
+}
+
+// forwardBody sets the body of out to stream the body of req, keeping its
+// length when the client sent one.
+func (p *Proxy) forwardBody(req *request.Request, out *client.Request) {
+	// BodyReader decodes bodies in full first, updating Content-Length, so
+	// it has to come before the headers are looked at.
+	body := req.BodyReader()
+	if length, ok := req.Headers.ContentLength(); ok {
+		if length > 0 {
+			out.Body = body
+			out.ContentLength = length
+		}
+		return
+	}
+
+	if _, chunked := req.Headers.Get("Transfer-Encoding"); chunked {
+		out.Body = body
+		out.ContentLength = -1
+	}
+}
+
+// forwardRequestHeaders copies the client's end-to-end headers to out and
+// adds the X-Forwarded-* and Via fields. out keeps its own Host.
+func (p *Proxy) forwardRequestHeaders(req *request.Request, out headers.Headers) {
+	h := headers.NewHeaders()
+	for name, value := range req.Headers {
+		h.Set(name, value)
+	}
+	removeHopByHop(h)
+	h.Delete("Host")
+	h.Delete("Content-Length")
+	h.Delete("Expect")
+
+	for name, value := range h {
+		out.Replace(name, value)
+	}
+
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior, ok := req.Headers.Get("X-Forwarded-For"); ok {
+			clientIP = prior + ", " + clientIP
+		}
+		out.Replace("X-Forwarded-For", clientIP)
+	}
+
+	out.Replace("X-Forwarded-Proto", "http")
+	if host, ok := req.Headers.Get("Host"); ok {
+		out.Replace("X-Forwarded-Host", host)
+	}
+
+	via := req.RequestLine.HttpVersion + " " + p.via
+	if prior, ok := req.Headers.Get("Via"); ok {
+		via = prior + ", " + via
+	}
+	out.Replace("Via", via)
+}
+
+// removeHopByHop drops the hop-by-hop fields from h, including any the
+// Connection header names.
+func removeHopByHop(h headers.Headers) {
+	if connection, ok := h.Get("Connection"); ok {
+		for _, name := range strings.Split(connection, ",") {
+			h.Delete(strings.TrimSpace(name))
+		}
+	}
+
+	for _, name := range hopByHopHeaders {
+		h.Delete(name)
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode) {
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(headers.NewHeaders())
+}
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyRequest(t *testing.T, p *Proxy, raw string) (*response.Response, string) {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:51234"
+
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetRequest(req)
+	w.EnableAutoFraming(16)
+	p.Handle(w, req)
+	require.NoError(t, w.Close())
+
+	resp, err := response.ResponseFromReader(&buf)
+	require.NoError(t, err)
+	return resp, string(resp.Body)
+}
+
+func TestProxy(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "secret")
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Add("Set-Cookie", "session=abc; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+		w.Header().Add("Set-Cookie", "theme=dark; Path=/")
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Repeat("z", 40)))
+		w.Header().Set("X-Checksum", "42")
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL + "/base")
+	require.NoError(t, err)
+
+	resp, body := proxyRequest(t, p, "POST /items?id=3 HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: X-Client-Hop\r\n"+
+		"X-Client-Hop: drop me\r\n"+
+		"X-Forwarded-For: 203.0.113.1\r\n"+
+		"TE: trailers\r\n"+
+		"Accept: text/plain\r\n"+
+		"\r\n"+
+		"hello")
+
+	// Test: Method, path, query, body and end-to-end headers are forwarded
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/base/items", got.URL.Path)
+	assert.Equal(t, "id=3", got.URL.RawQuery)
+	assert.Equal(t, "hello", gotBody)
+	assert.Equal(t, "text/plain", got.Header.Get("Accept"))
+	assert.Empty(t, got.Header.Get("X-Client-Hop"))
+	assert.Empty(t, got.Header.Get("Te"))
+	assert.Equal(t, "203.0.113.1, 192.0.2.7", got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", got.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "1.1 httpfromtcp", got.Header.Get("Via"))
+
+	// Test: The response is streamed back without hop-by-hop fields
+	assert.Equal(t, response.StatusCode(201), resp.ResponseLine.StatusCode)
+	assert.Equal(t, strings.Repeat("z", 40), body)
+	assert.Empty(t, resp.Headers["keep-alive"])
+	assert.Empty(t, resp.Headers["x-upstream-hop"])
+	assert.Equal(t, "a, b", resp.Headers["x-multi"])
+	assert.Equal(t, []string{
+		"session=abc; Expires=Wed, 21 Oct 2026 07:28:00 GMT",
+		"theme=dark; Path=/",
+	}, resp.Headers.Values("Set-Cookie"))
+	assert.Equal(t, "1.1 httpfromtcp", resp.Headers["via"])
+	assert.Equal(t, "42", resp.Trailers["x-checksum"])
+}
+
+func TestProxyEscapedPaths(t *testing.T) {
+	uris := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uris <- r.RequestURI
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL + "/base/")
+	require.NoError(t, err)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/anything/a%20b?x=1", "/base/anything/a%20b?x=1"},
+		{"/files/a%2Fb", "/base/files/a%2Fb"},
+		{"/search?q=a%20b&tag=x%2Fy", "/base/search?q=a%20b&tag=x%2Fy"},
+		{"/plain", "/base/plain"},
+	}
+	for _, tt := range tests {
+		resp, _ := proxyRequest(t, p, "GET "+tt.target+" HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode, tt.target)
+		assert.Equal(t, tt.want, <-uris, tt.target)
+	}
+
+	// Test: Malformed escapes are the client's fault
+	resp, _ := proxyRequest(t, p, "GET /bad%zz HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, response.BadRequest, resp.ResponseLine.StatusCode)
+}
+
+func TestProxyErrors(t *testing.T) {
+	// Test: An unreachable upstream is a bad gateway
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	addr := upstream.URL
+	upstream.Close()
+
+	p, err := New(addr)
+	require.NoError(t, err)
+	resp, _ := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, response.BadGateway, resp.ResponseLine.StatusCode)
+
+	// Test: A slow upstream is a gateway timeout
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	p, err = New(slow.URL, WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	resp, _ = proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, response.GatewayTimeout, resp.ResponseLine.StatusCode)
+
+	// Test: Invalid upstream URLs
+	_, err = New("ftp://example.com")
+	require.Error(t, err)
+}
+
+func TestProxyStreamsRequestBody(t *testing.T) {
+	firstPart := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		io.ReadFull(r.Body, buf)
+		firstPart <- string(buf)
+		rest, _ := io.ReadAll(r.Body)
+		w.Write(append(buf, rest...))
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nfirst\r\n"))
+	req, err := request.RequestHeadFromReader(pr)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetRequest(req)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Handle(w, req)
+		w.Close()
+	}()
+
+	// Test: The upstream sees the start of the body before the client
+	// has sent the rest
+	select {
+	case part := <-firstPart:
+		assert.Equal(t, "first", part)
+	case <-time.After(2 * time.Second):
+		t.Fatal("request body was not streamed upstream")
+	}
+
+	_, err = pw.Write([]byte("6\r\n, then\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	<-done
+
+	resp, err := response.ResponseFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "first, then", string(resp.Body))
+}
+
+func TestProxyUpstreamBodyFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, bufrw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufrw.WriteString("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\na\r\nonly 10 b.\r\n")
+		bufrw.Flush()
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+
+	// Test: Nothing was sent yet, so the client gets a proper 502
+	resp, body := proxyRequest(t, p, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, response.BadGateway, resp.ResponseLine.StatusCode)
+	assert.Empty(t, body)
+}
@@ -0,0 +1,221 @@
+package ranges
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/mgmaster24/httpfromtcp/internal/conditional"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+)
+
+var (
+	// ErrInvalid means a Range header is malformed or uses a unit other
+	// than bytes. The header is then ignored.
+	ErrInvalid = errors.New("invalid range")
+	// ErrUnsatisfiable means none of the requested ranges overlap the
+	// content, which is answered with 416.
+	ErrUnsatisfiable = errors.New("range not satisfiable")
+)
+
+// Range is a satisfiable byte range within content of a known size.
+type Range struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats r for the Content-Range field of content that is
+// size bytes long.
+func (r Range) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// Parse parses a Range field value such as "bytes=0-499, -500" against
+// content of the given size. Ranges running past the end are shortened,
+// and ranges starting past it are dropped; ErrUnsatisfiable is returned if
+// that leaves none.
+func Parse(value string, size int64) ([]Range, error) {
+	unit, set, ok := strings.Cut(value, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, value)
+	}
+
+	var ranges []Range
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalid, spec)
+		}
+
+		if first == "" {
+			suffix, err := parsePos(last)
+			if err != nil {
+				return nil, err
+			}
+
+			if suffix == 0 || size == 0 {
+				continue
+			}
+			suffix = min(suffix, size)
+			ranges = append(ranges, Range{Start: size - suffix, Length: suffix})
+			continue
+		}
+
+		start, err := parsePos(first)
+		if err != nil {
+			return nil, err
+		}
+
+		end := size - 1
+		if last != "" {
+			end, err = parsePos(last)
+			if err != nil {
+				return nil, err
+			}
+
+			if end < start {
+				return nil, fmt.Errorf("%w: %s", ErrInvalid, spec)
+			}
+			end = min(end, size-1)
+		}
+
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, Range{Start: start, Length: end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsatisfiable, value)
+	}
+	return ranges, nil
+}
+
+func parsePos(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %s", ErrInvalid, s)
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalid, s)
+	}
+	return n, nil
+}
+
+// ServeContent answers req with content, honouring conditional requests
+// against v and Range requests for GET. The fields in h, which must include
+// Content-Type, are sent with the response; for several ranges its
+// Content-Type moves into the parts. A single range is sent as 206
+// Partial Content with a Content-Range, several as a multipart/byteranges
+// body, and a range outside the content as 416. The Range field is
+// ignored when it is malformed, when If-Range doesn't match v, or when the
+// ranges add up to more than the content itself.
+func ServeContent(
+	w *response.Writer,
+	req *request.Request,
+	h headers.Headers,
+	v conditional.Validators,
+	content io.ReadSeeker,
+) error {
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+
+	if conditional.Check(w, req, v, h) {
+		return nil
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	contentType, _ := h.Get("Content-Type")
+	h.Set("Accept-Ranges", "bytes")
+	v.SetHeaders(h)
+
+	var ranges []Range
+	if value, ok := req.Headers.Get("Range"); ok && req.RequestLine.Method == "GET" && conditional.IfRange(req, v) {
+		ranges, err = Parse(value, size)
+		if errors.Is(err, ErrUnsatisfiable) {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteStatusLine(response.RangeNotSatisfiable)
+			return w.WriteHeaders(h)
+		}
+
+		if err != nil || sumLength(ranges) > size {
+			ranges = nil
+		}
+	}
+
+	send := req.RequestLine.Method != "HEAD"
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteStatusLine(response.Ok)
+		if err := w.WriteHeaders(h); err != nil || !send {
+			return err
+		}
+		return copyRange(w, content, Range{Start: 0, Length: size})
+	case 1:
+		h.Set("Content-Range", ranges[0].ContentRange(size))
+		h.Set("Content-Length", strconv.FormatInt(ranges[0].Length, 10))
+		w.WriteStatusLine(response.PartialContent)
+		if err := w.WriteHeaders(h); err != nil {
+			return err
+		}
+		return copyRange(w, content, ranges[0])
+	}
+
+	mw := multipart.NewWriter(w)
+	h.Replace("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteStatusLine(response.PartialContent)
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+
+	for _, r := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {r.ContentRange(size)},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := copyRange(part, content, r); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func sumLength(ranges []Range) int64 {
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	return total
+}
+
+func copyRange(dst io.Writer, content io.ReadSeeker, r Range) error {
+	if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err := io.CopyN(dst, content, r.Length)
+	return err
+}
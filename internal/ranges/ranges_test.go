@@ -0,0 +1,125 @@
+package ranges
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/conditional"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Single, open ended and suffix ranges
+	ranges, err := Parse("bytes=0-4, 95-, -3", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{0, 5}, {95, 5}, {97, 3}}, ranges)
+
+	// Test: Ranges are clamped to the content
+	ranges, err = Parse("bytes=90-200,-500", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{90, 10}, {0, 100}}, ranges)
+
+	// Test: Unsatisfiable ranges are dropped
+	ranges, err = Parse("bytes=100-, 10-19", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{10, 10}}, ranges)
+	_, err = Parse("bytes=100-200", 100)
+	require.ErrorIs(t, err, ErrUnsatisfiable)
+	_, err = Parse("bytes=-0", 100)
+	require.ErrorIs(t, err, ErrUnsatisfiable)
+
+	// Test: Malformed ranges
+	for _, value := range []string{"items=0-1", "bytes=5-1", "bytes=a-b", "bytes=1", "bytes=-"} {
+		_, err = Parse(value, 100)
+		require.ErrorIs(t, err, ErrInvalid, value)
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	modified := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	v := conditional.Validators{ETag: `"v1"`, LastModified: modified}
+	serve := func(fields ...string) *response.Response {
+		raw := "GET /file.txt HTTP/1.1\r\nHost: localhost\r\n"
+		for _, field := range fields {
+			raw += field + "\r\n"
+		}
+		req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		w := response.NewWriter(&buf)
+		w.SetRequest(req)
+		w.EnableAutoFraming(16)
+		h := headers.NewHeaders()
+		h.Set("Content-Type", "text/plain")
+		require.NoError(t, ServeContent(w, req, h, v, strings.NewReader(content)))
+		require.NoError(t, w.Close())
+
+		resp, err := response.ResponseFromReader(&buf)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// Test: No Range gets the whole content
+	resp := serve()
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "bytes", resp.Headers["accept-ranges"])
+	assert.Equal(t, content, string(resp.Body))
+
+	// Test: A single range
+	resp = serve("Range: bytes=10-15")
+	assert.Equal(t, response.PartialContent, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "bytes 10-15/36", resp.Headers["content-range"])
+	assert.Equal(t, "abcdef", string(resp.Body))
+
+	// Test: Several ranges use multipart/byteranges
+	resp = serve("Range: bytes=0-1, -2")
+	assert.Equal(t, response.PartialContent, resp.ResponseLine.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(resp.Headers["content-type"])
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	mr := multipart.NewReader(bytes.NewReader(resp.Body), params["boundary"])
+	for _, want := range []struct{ contentRange, data string }{
+		{"bytes 0-1/36", "01"},
+		{"bytes 34-35/36", "yz"},
+	} {
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, want.contentRange, part.Header.Get("Content-Range"))
+		assert.Equal(t, "text/plain", part.Header.Get("Content-Type"))
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, want.data, string(data))
+	}
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Unsatisfiable ranges get 416
+	resp = serve("Range: bytes=40-")
+	assert.Equal(t, response.RangeNotSatisfiable, resp.ResponseLine.StatusCode)
+	assert.Equal(t, "bytes */36", resp.Headers["content-range"])
+
+	// Test: Malformed ranges are ignored
+	resp = serve("Range: bytes=9-1")
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+
+	// Test: A stale If-Range gets the whole content
+	resp = serve("Range: bytes=0-1", `If-Range: "v0"`)
+	assert.Equal(t, response.Ok, resp.ResponseLine.StatusCode)
+	resp = serve("Range: bytes=0-1", `If-Range: "v1"`)
+	assert.Equal(t, response.PartialContent, resp.ResponseLine.StatusCode)
+
+	// Test: Preconditions are evaluated first
+	resp = serve("Range: bytes=0-1", `If-None-Match: "v1"`)
+	assert.Equal(t, response.NotModified, resp.ResponseLine.StatusCode)
+}
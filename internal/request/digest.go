@@ -0,0 +1,81 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+)
+
+var (
+	// ErrDigestMismatch means the body doesn't match a Content-Digest or
+	// Repr-Digest the client sent with it.
+	ErrDigestMismatch = errors.New("body does not match its digest")
+	// ErrDigestUnsupported means the client sent a digest, but only with
+	// algorithms that verification wasn't enabled for.
+	ErrDigestUnsupported = errors.New("no supported digest algorithm")
+)
+
+// VerifyDigests makes reading the body check it against any Content-Digest
+// or Repr-Digest field the client sent, in the headers or the trailers,
+// using the given algorithms. The body is hashed as it is read, and
+// ReadBody fails with ErrDigestMismatch or ErrDigestUnsupported when the
+// check fails. Requests without a digest are accepted as they are. It must
+// be called before the body is read.
+func (r *Request) VerifyDigests(algs ...digest.Algorithm) {
+	r.digests = make(map[digest.Algorithm]hash.Hash)
+	for _, alg := range algs {
+		if h := alg.New(); h != nil {
+			r.digests[alg] = h
+		}
+	}
+}
+
+func (r *Request) appendBody(p []byte) {
+	r.Body = append(r.Body, p...)
+	r.bodyLength += len(p)
+	for _, h := range r.digests {
+		h.Write(p)
+	}
+}
+
+func (r *Request) verifyDigests() error {
+	if r.digests == nil {
+		return nil
+	}
+
+	for _, fields := range []headers.Headers{r.Headers, r.Trailers} {
+		for _, name := range []string{"Content-Digest", "Repr-Digest"} {
+			value, ok := fields.Get(name)
+			if !ok {
+				continue
+			}
+
+			sums, err := digest.Parse(value)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrDigestMismatch, err)
+			}
+
+			checked := false
+			for alg, sum := range sums {
+				h, ok := r.digests[alg]
+				if !ok {
+					continue
+				}
+
+				if !bytes.Equal(h.Sum(nil), sum) {
+					return fmt.Errorf("%w: %s %s", ErrDigestMismatch, name, alg)
+				}
+				checked = true
+			}
+
+			if !checked {
+				return fmt.Errorf("%w: %s", ErrDigestUnsupported, value)
+			}
+		}
+	}
+	return nil
+}
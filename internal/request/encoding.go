@@ -0,0 +1,125 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrBodyTooLarge means the body, after any decoding, is longer than the
+	// limit set with LimitBody.
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrUnsupportedEncoding means the body has a Content-Encoding that
+	// can't be decoded.
+	ErrUnsupportedEncoding = errors.New("unsupported content coding")
+)
+
+// DefaultMaxDecodedSize caps bodies that DecodeBody decodes when no limit
+// was set with LimitBody, so that a small compressed body can't be made to
+// exhaust memory.
+const DefaultMaxDecodedSize = 10 << 20
+
+// LimitBody caps the body at n bytes. Reading a longer body fails with
+// ErrBodyTooLarge; when the body is decoded the cap applies to the decoded
+// bytes as well, so a small compressed body can't expand without bound. It
+// returns ErrBodyTooLarge right away when Content-Length already exceeds
+// n. It must be called before the body is read.
+func (r *Request) LimitBody(n int) error {
+	r.maxBodySize = n
+	if length, ok := r.Headers.ContentLength(); ok && length > int64(n) {
+		return fmt.Errorf("%w: content-length %d", ErrBodyTooLarge, length)
+	}
+	return nil
+}
+
+// DecodeBody makes ReadBody undo a gzip or deflate Content-Encoding, so
+// Body holds the decoded bytes. Content-Encoding is then removed from the
+// headers and any Content-Length is updated to the decoded length. Digests
+// are verified against the body as it was sent. Without a LimitBody the
+// body, both as sent and decoded, is capped at DefaultMaxDecodedSize. It
+// returns ErrUnsupportedEncoding right away for any other coding. It must
+// be called before the body is read.
+func (r *Request) DecodeBody() error {
+	value, ok := r.Headers.Get("Content-Encoding")
+	if !ok {
+		return nil
+	}
+
+	var codings []string
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "identity", "":
+		case "gzip", "x-gzip", "deflate":
+			codings = append(codings, coding)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, coding)
+		}
+	}
+
+	r.codings = codings
+	if len(codings) > 0 && r.maxBodySize == 0 {
+		return r.LimitBody(DefaultMaxDecodedSize)
+	}
+	return nil
+}
+
+func (r *Request) checkBodySize(n int) error {
+	if r.maxBodySize > 0 && n > r.maxBodySize {
+		return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, r.maxBodySize)
+	}
+	return nil
+}
+
+// decodeBody removes the content codings in the reverse of the order they
+// were applied.
+func (r *Request) decodeBody() error {
+	if len(r.codings) == 0 {
+		return nil
+	}
+
+	body := r.Body
+	for i := len(r.codings) - 1; i >= 0; i-- {
+		var (
+			dec io.ReadCloser
+			err error
+		)
+		if r.codings[i] == "deflate" {
+			dec, err = zlib.NewReader(bytes.NewReader(body))
+		} else {
+			dec, err = gzip.NewReader(bytes.NewReader(body))
+		}
+		if err != nil {
+			return fmt.Errorf("decoding %s body: %w", r.codings[i], err)
+		}
+
+		src := io.Reader(dec)
+		if r.maxBodySize > 0 {
+			src = io.LimitReader(dec, int64(r.maxBodySize)+1)
+		}
+
+		body, err = io.ReadAll(src)
+		dec.Close()
+		if err != nil {
+			return fmt.Errorf("decoding %s body: %w", r.codings[i], err)
+		}
+
+		r.Body = body
+		if err := r.checkBodySize(len(r.Body)); err != nil {
+			return err
+		}
+	}
+
+	r.codings = nil
+	r.Headers.Delete("Content-Encoding")
+	if _, ok := r.Headers.Get("Content-Length"); ok {
+		r.Headers.Replace("Content-Length", strconv.Itoa(len(r.Body)))
+	}
+	return nil
+}
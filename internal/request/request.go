@@ -4,18 +4,36 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"strconv"
 	"strings"
 
+	"github.com/mgmaster24/httpfromtcp/internal/chunked"
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
 	"github.com/mgmaster24/httpfromtcp/internal/headers"
 )
 
 type Request struct {
 	Body        []byte
 	Headers     headers.Headers
+	Trailers    headers.Headers
 	RequestLine RequestLine
+	// RemoteAddr is the address of the client, set by the server.
+	RemoteAddr  string
 	state       parserState
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	onBodyRead  func() error
+
+	chunks       *chunked.Parser
+	bodyLength   int
+	bodyErr      error
+	bodyStreamed bool
+	digests      map[digest.Algorithm]hash.Hash
+	maxBodySize  int
+	codings      []string
 }
 
 type RequestLine struct {
@@ -35,63 +53,219 @@ const (
 	Initialized    parserState = 0
 	ParsingHeaders parserState = 1
 	ParsingBody    parserState = 2
+	ParsingChunks  parserState = 3
 	Done           parserState = 42
 )
 
+// RequestFromReader parses a complete request, body included, from reader.
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	request, err := RequestHeadFromReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := request.ReadBody(); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// RequestHeadFromReader parses the request line and headers from reader and
+// stops before the body. The body is read from the same reader by the first
+// call to ReadBody, so nothing else may read from reader in between.
+func RequestHeadFromReader(reader io.Reader) (*Request, error) {
 	request := &Request{
-		state:   Initialized,
-		Headers: headers.NewHeaders(),
-		Body:    make([]byte, 0),
+		state:    Initialized,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		Body:     make([]byte, 0),
+		reader:   reader,
+		buf:      make([]byte, bufferSize, bufferSize),
+	}
+
+	if err := request.readUntil(ParsingBody); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// ReadBody reads the rest of the body if it has not been read yet and
+// returns it. It is safe to call more than once.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.state == Done {
+		return r.Body, nil
+	}
+
+	if r.bodyErr != nil {
+		return nil, r.bodyErr
+	}
+
+	if err := r.startBody(); err != nil {
+		return nil, err
+	}
+
+	if err := r.readUntil(Done); err != nil {
+		r.bodyErr = err
+		return nil, err
+	}
+
+	return r.Body, nil
+}
+
+// BodyError returns the error that stopped the body from being read, or
+// nil when it was read in full or not read at all.
+func (r *Request) BodyError() error {
+	return r.bodyErr
+}
+
+// BodyReader returns a reader that streams the body from the connection
+// instead of collecting all of it in Body; the bytes it hands out are
+// removed from Body. Read fails with the same errors as ReadBody. A body
+// that has to be decoded is read in full by BodyReader itself, since
+// decoding needs all of it, so the headers describe the decoded body once
+// BodyReader returns.
+func (r *Request) BodyReader() io.Reader {
+	b := &bodyReader{request: r}
+	if len(r.codings) > 0 {
+		_, b.err = r.ReadBody()
+	}
+	return b
+}
+
+type bodyReader struct {
+	request *Request
+	err     error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	r := b.request
+	if r.bodyErr != nil {
+		return 0, r.bodyErr
+	}
+
+	if err := r.startBody(); err != nil {
+		b.err = err
+		return 0, err
 	}
 
-	readToIndex := 0
-	buf := make([]byte, bufferSize, bufferSize)
-	for request.state != Done {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	for len(r.Body) == 0 {
+		if r.state == Done {
+			return 0, io.EOF
 		}
 
-		bytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(io.EOF, err) {
-				if request.state != Done {
-					return nil, fmt.Errorf(
-						"incomplete request, in state: %d, read n bytes on EOF: %d",
-						request.state,
-						bytesRead,
-					)
-				}
-				break
-			}
-			return nil, err
+		if err := r.advance(Done); err != nil {
+			r.bodyErr = err
+			return 0, err
 		}
+	}
 
-		readToIndex += bytesRead
-		bytesParsed, err := request.parse(buf[:readToIndex])
-		if err != nil {
-			return nil, err
+	n := copy(p, r.Body)
+	r.Body = r.Body[n:]
+	r.bodyStreamed = true
+	return n, nil
+}
+
+// startBody runs the OnBodyRead hook the first time the body is read.
+func (r *Request) startBody() error {
+	if r.onBodyRead == nil {
+		return nil
+	}
+
+	onBodyRead := r.onBodyRead
+	r.onBodyRead = nil
+	return onBodyRead()
+}
+
+// OnBodyRead registers fn to run once, right before the body is first read
+// from the connection. The server uses it to answer Expect: 100-continue
+// only when a handler actually asks for the body.
+func (r *Request) OnBodyRead(fn func() error) {
+	r.onBodyRead = fn
+}
+
+// ExpectsContinue reports whether the client is waiting for a 100 Continue
+// before it sends the body.
+func (r *Request) ExpectsContinue() bool {
+	expect, ok := r.Headers.Get("Expect")
+	return ok && strings.EqualFold(expect, "100-continue")
+}
+
+func (r *Request) readUntil(target parserState) error {
+	for r.state < target {
+		if err := r.advance(target); err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// advance parses what has been buffered and reads more from the reader
+// only when that made no progress, so that body bytes already buffered are
+// handed out before blocking on the connection.
+func (r *Request) advance(target parserState) error {
+	bytesParsed, err := r.parse(r.buf[:r.readToIndex], target)
+	if err != nil {
+		return err
+	}
 
-		copy(buf, buf[bytesParsed:readToIndex])
-		readToIndex -= bytesParsed
+	copy(r.buf, r.buf[bytesParsed:r.readToIndex])
+	r.readToIndex -= bytesParsed
+	if r.state >= target || bytesParsed > 0 {
+		return nil
 	}
 
-	return request, nil
+	if r.readToIndex >= len(r.buf) {
+		newBuf := make([]byte, len(r.buf)*2)
+		copy(newBuf, r.buf)
+		r.buf = newBuf
+	}
+
+	bytesRead, err := r.reader.Read(r.buf[r.readToIndex:])
+	r.readToIndex += bytesRead
+	if err != nil {
+		if errors.Is(err, io.EOF) && bytesRead > 0 {
+			return nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf(
+				"incomplete request, in state: %d, read n bytes on EOF: %d",
+				r.state,
+				bytesRead,
+			)
+		}
+		return err
+	}
+	return nil
 }
 
-func (r *Request) parse(data []byte) (int, error) {
+func (r *Request) parse(data []byte, target parserState) (int, error) {
 	totalBytesParsed := 0
-	for r.state != Done {
+	for r.state < target {
+		prevState := r.state
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
 		}
 
+		if r.state == Done {
+			if err := r.verifyDigests(); err != nil {
+				return 0, err
+			}
+
+			if err := r.decodeBody(); err != nil {
+				return 0, err
+			}
+		}
+
 		totalBytesParsed += n
-		if n == 0 {
+		if n == 0 && r.state == prevState {
 			break
 		}
 	}
@@ -120,32 +294,66 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		}
 
 		if done {
+			if err := r.validateHost(); err != nil {
+				return 0, err
+			}
 			r.state = ParsingBody
 		}
 		return n, nil
 	case ParsingBody:
 		contentLengthHeader, ok := r.Headers.Get("Content-Length")
+		if te, hasEncoding := r.Headers.Get("Transfer-Encoding"); hasEncoding {
+			if ok {
+				return 0, fmt.Errorf("both Transfer-Encoding and Content-Length present")
+			}
+
+			if !strings.EqualFold(strings.TrimSpace(te), "chunked") {
+				return 0, fmt.Errorf("unsupported transfer coding: %s", te)
+			}
+
+			r.chunks = chunked.NewParser(r.Trailers)
+			r.state = ParsingChunks
+			return 0, nil
+		}
+
 		if !ok {
 			r.state = Done
 			return 0, nil
 		}
 
-		r.Body = append(r.Body, data...)
+		r.appendBody(data)
 		intCl, err := strconv.Atoi(contentLengthHeader)
 		if err != nil {
 			return 0, err
 		}
 
-		if len(r.Body) > intCl {
+		if r.bodyLength > intCl {
 			return 0, fmt.Errorf("invalid body length")
 		}
 
-		if len(r.Body) == intCl {
+		if r.bodyLength == intCl {
 			r.state = Done
 		}
 
 		return len(data), nil
 
+	case ParsingChunks:
+		n, chunk, done, err := r.chunks.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(chunk) > 0 {
+			r.appendBody(chunk)
+			if err := r.checkBodySize(r.bodyLength); err != nil {
+				return 0, err
+			}
+		}
+
+		if done {
+			r.state = Done
+		}
+		return n, nil
 	case Done:
 		return 0, fmt.Errorf("trying to read data in Done state")
 	default:
@@ -153,6 +361,27 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	}
 }
 
+// validateHost enforces that an HTTP/1.1 request carries exactly one Host
+// field. Repeated fields are folded into a single comma separated value by
+// the header parser, and a host can never contain a comma, so a comma in the
+// value means the field was sent more than once. HTTP/1.0 predates Host, so
+// it may be missing there.
+func (r *Request) validateHost() error {
+	host, ok := r.Headers.Get("Host")
+	if !ok {
+		if r.RequestLine.HttpVersion == "1.0" {
+			return nil
+		}
+		return fmt.Errorf("missing Host header")
+	}
+
+	if strings.Contains(host, ",") {
+		return fmt.Errorf("duplicate Host header: %s", host)
+	}
+
+	return nil
+}
+
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	idx := bytes.Index(data, []byte(crlf))
 	if idx == -1 {
@@ -190,7 +419,7 @@ func requestLineFromString(str string) (*RequestLine, error) {
 	}
 
 	version := versionParts[1]
-	if version != "1.1" {
+	if version != "1.1" && version != "1.0" {
 		return nil, fmt.Errorf("unrecognized HTTP-version: %s", str)
 	}
 
@@ -1,9 +1,15 @@
 package request
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"io"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -121,25 +127,41 @@ func TestParseHeadersAndRequest(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
 
-	// Test: Empty Headers
+	// Test: Empty Headers (missing Host)
 	reader = &chunkReader{
 		data:            "GET / HTTP/1.1\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Duplicate Headers
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nAccept: text/html\r\nAccept: */*\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Empty(t, r.Headers)
+	assert.Equal(t, "text/html, */*", r.Headers["accept"])
 
-	// Test: Duplicate Headers
+	// Test: Duplicate Host Headers
 	reader = &chunkReader{
 		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: duplicate:8080\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Empty Host is allowed
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost:\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, duplicate:8080", r.Headers["host"])
+	assert.Equal(t, "", r.Headers["host"])
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -214,3 +236,456 @@ func TestBodyParse(t *testing.T) {
 	require.NotNil(t, r)
 	assert.Equal(t, "", string(r.Body))
 }
+
+func TestExpectContinue(t *testing.T) {
+	// Test: Body is left unread until ReadBody, which runs the hook first
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Expect: 100-continue\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestHeadFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.True(t, r.ExpectsContinue())
+	assert.Equal(t, "", string(r.Body))
+
+	calls := 0
+	r.OnBodyRead(func() error {
+		calls++
+		return nil
+	})
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Equal(t, 1, calls)
+
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Equal(t, 1, calls)
+
+	// Test: A failing hook aborts the body read
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Expect: 100-Continue\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestHeadFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.ExpectsContinue())
+	r.OnBodyRead(func() error { return io.ErrClosedPipe })
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestHTTP10Request(t *testing.T) {
+	// Test: HTTP/1.0 requests may omit Host
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.0\r\nUser-Agent: curl/7.81.0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+
+	// Test: Other versions are still rejected
+	reader = &chunkReader{
+		data:            "GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6;name=value\r\nhello \r\n" +
+			"7\r\nworld!\n\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers["x-checksum"])
+
+	// Test: Bad chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Chunk longer than its size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Transfer-Encoding and Content-Length together
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestVerifyDigests(t *testing.T) {
+	// sha-256 of "hello world!\n"
+	const helloDigest = "sha-256=:7PcB9yfZ4td8SqSaxvu8yZcnisoBC93uuWHBDPVNQ1o=:"
+	verify := func(data string) (*Request, error) {
+		r, err := RequestHeadFromReader(&chunkReader{data: data, numBytesPerRead: 3})
+		require.NoError(t, err)
+		r.VerifyDigests(digest.SHA256, digest.SHA512)
+		_, err = r.ReadBody()
+		return r, err
+	}
+
+	// Test: Matching Content-Digest header
+	_, err := verify("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 13\r\n" +
+		"Content-Digest: " + helloDigest + "\r\n" +
+		"\r\n" +
+		"hello world!\n")
+	require.NoError(t, err)
+
+	// Test: Mismatching Repr-Digest header
+	_, err = verify("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 13\r\n" +
+		"Repr-Digest: " + helloDigest + "\r\n" +
+		"\r\n" +
+		"hello world?\n")
+	require.ErrorIs(t, err, ErrDigestMismatch)
+
+	// Test: Matching Content-Digest trailer on a chunked body
+	_, err = verify("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: Content-Digest\r\n" +
+		"\r\n" +
+		"d\r\nhello world!\n\r\n" +
+		"0\r\n" +
+		"Content-Digest: " + helloDigest + "\r\n" +
+		"\r\n")
+	require.NoError(t, err)
+
+	// Test: Mismatching Content-Digest trailer on a chunked body
+	_, err = verify("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"d\r\nhello world?\n\r\n" +
+		"0\r\n" +
+		"Content-Digest: " + helloDigest + "\r\n" +
+		"\r\n")
+	require.ErrorIs(t, err, ErrDigestMismatch)
+
+	// Test: Only unsupported algorithms
+	_, err = verify("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 13\r\n" +
+		"Content-Digest: md5=:AAAA:\r\n" +
+		"\r\n" +
+		"hello world!\n")
+	require.ErrorIs(t, err, ErrDigestUnsupported)
+
+	// Test: No digest at all
+	_, err = verify("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 13\r\n" +
+		"\r\n" +
+		"hello world!\n")
+	require.NoError(t, err)
+}
+
+func TestDecodeBody(t *testing.T) {
+	compress := func(coding string, data []byte) string {
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+		if coding == "gzip" {
+			zw = gzip.NewWriter(&buf)
+		} else {
+			zw = zlib.NewWriter(&buf)
+		}
+		zw.Write(data)
+		zw.Close()
+		return buf.String()
+	}
+	decode := func(coding string, body string, limit int) (*Request, error) {
+		r, err := RequestHeadFromReader(&chunkReader{
+			data: "POST /telemetry HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Content-Encoding: " + coding + "\r\n" +
+				"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+				"\r\n" + body,
+			numBytesPerRead: 7,
+		})
+		require.NoError(t, err)
+		if err := r.LimitBody(limit); err != nil {
+			return r, err
+		}
+		if err := r.DecodeBody(); err != nil {
+			return r, err
+		}
+		_, err = r.ReadBody()
+		return r, err
+	}
+
+	// Test: gzip body is decoded and the headers describe the result
+	r, err := decode("gzip", compress("gzip", []byte("hello world!\n")), 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "13", r.Headers["content-length"])
+	_, ok := r.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+
+	// Test: deflate body is decoded
+	r, err = decode("deflate", compress("deflate", []byte("hello world!\n")), 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Stacked codings are removed in reverse order
+	r, err = decode("deflate, gzip", compress("gzip", []byte(compress("deflate", []byte("stacked")))), 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "stacked", string(r.Body))
+
+	// Test: The limit applies to the decoded body
+	bomb := compress("gzip", make([]byte, 1<<20))
+	_, err = decode("gzip", bomb, 4096)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: A declared length over the limit is refused before reading
+	_, err = decode("gzip", bomb, 16)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Without a limit, decoded bodies are capped by default
+	r, err = RequestHeadFromReader(strings.NewReader("POST /telemetry HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Encoding: gzip\r\n" +
+		"Content-Length: " + strconv.Itoa(len(bomb)) + "\r\n" +
+		"\r\n" + bomb))
+	require.NoError(t, err)
+	require.NoError(t, r.DecodeBody())
+	assert.Equal(t, DefaultMaxDecodedSize, r.maxBodySize)
+
+	// Test: Unknown codings are refused
+	_, err = decode("br", "whatever", 1024)
+	require.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	// Test: A chunked body over the limit
+	r, err = RequestHeadFromReader(&chunkReader{
+		data: "POST /telemetry HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a\r\n0123456789\r\n" +
+			"a\r\n0123456789\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	require.NoError(t, err)
+	require.NoError(t, r.LimitBody(15))
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestWrite(t *testing.T) {
+	roundTrip := func(raw string) (*Request, string) {
+		t.Helper()
+		parsed, err := RequestFromReader(&chunkReader{data: raw, numBytesPerRead: 3})
+		require.NoError(t, err)
+
+		var b bytes.Buffer
+		require.NoError(t, parsed.Write(&b))
+
+		again, err := RequestFromReader(&chunkReader{data: b.String(), numBytesPerRead: 3})
+		require.NoError(t, err)
+		assert.Equal(t, parsed.RequestLine, again.RequestLine)
+		assert.Equal(t, parsed.Headers, again.Headers)
+		assert.Equal(t, parsed.Trailers, again.Trailers)
+		assert.Equal(t, parsed.Body, again.Body)
+		return parsed, b.String()
+	}
+
+	// Test: Host first, the other fields sorted, body with Content-Length
+	_, wire := roundTrip("POST /submit?x=1 HTTP/1.1\r\n" +
+		"User-Agent: test\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Accept: */*\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello")
+	assert.Equal(t, "POST /submit?x=1 HTTP/1.1\r\n"+
+		"host: localhost:42069\r\n"+
+		"accept: */*\r\n"+
+		"content-length: 5\r\n"+
+		"user-agent: test\r\n"+
+		"\r\n"+
+		"hello", wire)
+
+	// Test: Chunked bodies stay chunked, with their trailers
+	_, wire = roundTrip("POST /upload HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: X-Checksum\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\n" +
+		"X-Checksum: abc\r\n" +
+		"\r\n")
+	assert.Equal(t, "POST /upload HTTP/1.1\r\n"+
+		"host: localhost\r\n"+
+		"trailer: X-Checksum\r\n"+
+		"transfer-encoding: chunked\r\n"+
+		"\r\n"+
+		"c\r\nhello, world\r\n0\r\n"+
+		"x-checksum: abc\r\n"+
+		"\r\n", wire)
+
+	// Test: No body and no framing
+	_, wire = roundTrip("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, "GET / HTTP/1.1\r\nhost: localhost\r\n\r\n", wire)
+
+	// Test: An empty chunked body
+	roundTrip("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+
+	// Test: HTTP/1.0 without Host
+	_, wire = roundTrip("GET /old HTTP/1.0\r\n\r\n")
+	assert.Equal(t, "GET /old HTTP/1.0\r\n\r\n", wire)
+
+	// Test: Bodies of built requests get a Content-Length
+	req := &Request{
+		Body:        []byte("data"),
+		Headers:     map[string]string{"host": "example.com"},
+		RequestLine: RequestLine{Method: "PUT", RequestTarget: "/item"},
+	}
+	var b bytes.Buffer
+	require.NoError(t, req.Write(&b))
+	assert.Equal(t, "PUT /item HTTP/1.1\r\nhost: example.com\r\ncontent-length: 4\r\n\r\ndata", b.String())
+
+	// Test: Proxy form resolves origin-form targets against Host
+	b.Reset()
+	require.NoError(t, req.WriteProxy(&b))
+	assert.True(t, strings.HasPrefix(b.String(), "PUT http://example.com/item HTTP/1.1\r\n"))
+
+	parsed, err := RequestFromReader(&b)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/item", parsed.RequestLine.RequestTarget)
+	assert.Equal(t, "data", string(parsed.Body))
+
+	// Test: Absolute and authority forms are sent unchanged
+	b.Reset()
+	req.RequestLine = RequestLine{Method: "CONNECT", RequestTarget: "example.com:443"}
+	req.Body = nil
+	require.NoError(t, req.WriteProxy(&b))
+	assert.True(t, strings.HasPrefix(b.String(), "CONNECT example.com:443 HTTP/1.1\r\n"))
+
+	// Test: Proxy form needs a Host for origin-form targets
+	req = &Request{Headers: map[string]string{}, RequestLine: RequestLine{Method: "GET", RequestTarget: "/"}}
+	require.Error(t, req.WriteProxy(&b))
+
+	// Test: A body still on the connection is read before it is written
+	raw := "POST /late HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nlate"
+	req, err = RequestHeadFromReader(&chunkReader{data: raw, numBytesPerRead: 3})
+	require.NoError(t, err)
+	b.Reset()
+	require.NoError(t, req.Write(&b))
+	assert.True(t, strings.HasSuffix(b.String(), "\r\n\r\nlate"))
+
+	// Test: A body handed out by BodyReader can't be written
+	req, err = RequestHeadFromReader(&chunkReader{data: raw, numBytesPerRead: 3})
+	require.NoError(t, err)
+	_, err = io.ReadAll(req.BodyReader())
+	require.NoError(t, err)
+	require.ErrorIs(t, req.Write(&b), ErrBodyStreamed)
+
+	// Test: WriteHead leaves the body and its framing alone
+	b.Reset()
+	req = &Request{
+		Body:        []byte("ignored"),
+		Headers:     map[string]string{"x-b": "2", "host": "example.com", "transfer-encoding": "chunked"},
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/up"},
+	}
+	require.NoError(t, req.WriteHead(&b))
+	assert.Equal(t, "POST /up HTTP/1.1\r\nhost: example.com\r\ntransfer-encoding: chunked\r\nx-b: 2\r\n\r\n", b.String())
+}
+
+func TestBodyReader(t *testing.T) {
+	raw := "POST /upload HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n7\r\n, world\r\n0\r\n" +
+		"\r\n"
+
+	// Test: The body streams without collecting in Body
+	req, err := RequestHeadFromReader(&chunkReader{data: raw, numBytesPerRead: 4})
+	require.NoError(t, err)
+	called := false
+	req.OnBodyRead(func() error {
+		called = true
+		return nil
+	})
+	body, err := io.ReadAll(req.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(body))
+	assert.True(t, called)
+	assert.Empty(t, req.Body)
+
+	// Test: Limits apply to what was streamed
+	req, err = RequestHeadFromReader(&chunkReader{data: raw, numBytesPerRead: 4})
+	require.NoError(t, err)
+	require.NoError(t, req.LimitBody(8))
+	_, err = io.ReadAll(req.BodyReader())
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Encoded bodies are decoded up front
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("decoded"))
+	zw.Close()
+	req, err = RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\n" +
+		"Content-Encoding: gzip\r\nContent-Length: " + strconv.Itoa(gz.Len()) + "\r\n\r\n" + gz.String()))
+	require.NoError(t, err)
+	require.NoError(t, req.DecodeBody())
+	reader := req.BodyReader()
+	assert.Equal(t, "7", req.Headers["content-length"])
+	body, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "decoded", string(body))
+}
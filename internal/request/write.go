@@ -0,0 +1,179 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+)
+
+// ErrBodyStreamed means the body was read with BodyReader, so the request
+// no longer holds it and can't be written.
+var ErrBodyStreamed = errors.New("request body was streamed")
+
+// Write writes r in wire format: the request line with the target as it
+// is, the Host field followed by the others sorted by name, then the body.
+// An HTTP/1.1 request that came in chunked, or that has trailers, is sent
+// as a single chunk followed by the trailers; any other body gets a
+// Content-Length. The body is written from r.Body; a parsed request whose
+// body is still on the connection has the rest of it read first, and one
+// whose body was handed out by BodyReader fails with ErrBodyStreamed.
+// Writing a parsed request and parsing the result gives the same request
+// back.
+func (r *Request) Write(w io.Writer) error {
+	return r.write(w, r.RequestLine.RequestTarget)
+}
+
+// WriteProxy is like Write but sends the target in absolute form, as a
+// request to a forward proxy must. Origin-form targets are resolved against
+// the Host field; other forms are sent unchanged.
+func (r *Request) WriteProxy(w io.Writer) error {
+	target := r.RequestLine.RequestTarget
+	if strings.HasPrefix(target, "/") {
+		host, ok := r.Headers.Get("Host")
+		if !ok || host == "" {
+			return fmt.Errorf("request has no Host header")
+		}
+		target = "http://" + host + target
+	}
+	return r.write(w, target)
+}
+
+func (r *Request) write(w io.Writer, target string) error {
+	if r.bodyStreamed {
+		return ErrBodyStreamed
+	}
+
+	if r.reader != nil {
+		if _, err := r.ReadBody(); err != nil {
+			return err
+		}
+	}
+
+	h := headers.NewHeaders()
+	for name, value := range r.Headers {
+		h.Set(name, value)
+	}
+
+	chunked := r.writesChunked()
+	if chunked {
+		h.Delete("Content-Length")
+		h.Replace("Transfer-Encoding", "chunked")
+	} else {
+		_, hasLength := h.Get("Content-Length")
+		h.Delete("Transfer-Encoding")
+		if hasLength || len(r.Body) > 0 {
+			h.Replace("Content-Length", strconv.Itoa(len(r.Body)))
+		}
+	}
+
+	if err := r.writeHead(w, target, h); err != nil {
+		return err
+	}
+
+	if !chunked {
+		_, err := w.Write(r.Body)
+		return err
+	}
+
+	if len(r.Body) > 0 {
+		if _, err := fmt.Fprintf(w, "%x\r\n", len(r.Body)); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(r.Body); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, crlf); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "0\r\n"); err != nil {
+		return err
+	}
+	return writeFields(w, r.Trailers)
+}
+
+// WriteHead writes the request line and the headers as they are, the Host
+// field first and the others sorted by name, leaving the body and its
+// framing to the caller.
+func (r *Request) WriteHead(w io.Writer) error {
+	return r.writeHead(w, r.RequestLine.RequestTarget, r.Headers)
+}
+
+func (r *Request) writeHead(w io.Writer, target string, h headers.Headers) error {
+	version := r.RequestLine.HttpVersion
+	if version == "" {
+		version = "1.1"
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s HTTP/%s\r\n", r.RequestLine.Method, target, version)
+	if err != nil {
+		return err
+	}
+
+	host, ok := h.Get("Host")
+	if ok {
+		if _, err := fmt.Fprintf(w, "host: %s\r\n", host); err != nil {
+			return err
+		}
+	}
+
+	fields := h
+	if ok {
+		fields = headers.NewHeaders()
+		for name, value := range h {
+			if name != "host" {
+				fields[name] = value
+			}
+		}
+	}
+	return writeFields(w, fields)
+}
+
+// writesChunked reports whether Write sends the body chunked. HTTP/1.0 has
+// no chunked coding, so those requests always get a Content-Length.
+func (r *Request) writesChunked() bool {
+	if r.RequestLine.HttpVersion == "1.0" {
+		return false
+	}
+
+	if len(r.Trailers) > 0 {
+		return true
+	}
+
+	te, ok := r.Headers.Get("Transfer-Encoding")
+	if !ok {
+		return false
+	}
+
+	codings := strings.Split(te, ",")
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+}
+
+// writeFields writes h sorted by name and ends the section with an empty
+// line.
+func writeFields(w io.Writer, h headers.Headers) error {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range h.Values(name) {
+			if _, err := fmt.Fprintf(w, "%s: %s\r\n", name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, crlf)
+	return err
+}
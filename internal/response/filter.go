@@ -0,0 +1,68 @@
+package response
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+)
+
+// Head is the part of a response a Filter may rewrite before it is sent.
+type Head struct {
+	StatusCode StatusCode
+	Headers    headers.Headers
+	// Body is the complete body when auto framing buffered all of it. It
+	// is nil when the body is streamed after the headers.
+	Body []byte
+}
+
+// Chunked reports whether the body will be sent with chunked encoding, and
+// so can be followed by trailers.
+func (h *Head) Chunked() bool {
+	return isChunked(h.Headers)
+}
+
+// A Filter sees every response written through a Writer it was added to.
+// Header is called once, right before the status line and headers are
+// written, and may change them.
+type Filter interface {
+	Header(head *Head)
+}
+
+// A BodyFilter also sits in the path of the body. Body is called when the
+// handler first writes body bytes, with the head as the handler set it,
+// and returns the writer those bytes go through on their way to dst. The
+// returned writer is closed once the handler is done, before the body is
+// ended.
+type BodyFilter interface {
+	Filter
+	Body(dst io.Writer, head *Head) io.WriteCloser
+}
+
+// A TrailerFilter adds fields to the trailer section of a chunked body.
+// Those fields must be named in a Trailer header set from Header.
+type TrailerFilter interface {
+	Filter
+	Trailers(h headers.Headers)
+}
+
+// A ResettableFilter keeps state about the response it sees. Reset drops
+// that state when the response is thrown away with Writer.Reset, so that
+// the filter sees its replacement from the start.
+type ResettableFilter interface {
+	Filter
+	Reset()
+}
+
+// AddFilter adds f to the writer. Filters must be added before the headers
+// are committed. The filter added last is closest to the handler: it sees
+// the body first and its Header runs first, so middleware added in the
+// order it is nested behaves as expected.
+func (w *Writer) AddFilter(f Filter) error {
+	if w.body != nil || w.state > Body || (w.state == Body && w.pending == nil) {
+		return fmt.Errorf("filters must be added before the headers are written")
+	}
+
+	w.filters = append(w.filters, f)
+	return nil
+}
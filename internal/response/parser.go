@@ -0,0 +1,349 @@
+package response
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mgmaster24/httpfromtcp/internal/chunked"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+)
+
+// Response is a response parsed from a reader, the counterpart of
+// request.Request.
+type Response struct {
+	ResponseLine ResponseLine
+	Headers      headers.Headers
+	Trailers     headers.Headers
+	Body         []byte
+	// Interim holds the 1xx responses received before the final one.
+	Interim []InterimResponse
+
+	state         parserState
+	reader        io.Reader
+	buf           []byte
+	readToIndex   int
+	bodyRemaining int
+	chunks        *chunked.Parser
+}
+
+type ResponseLine struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+// InterimResponse is a 1xx response that preceded the final one.
+type InterimResponse struct {
+	ResponseLine ResponseLine
+	Headers      headers.Headers
+}
+
+const (
+	crlf            = "\r\n"
+	parseBufferSize = 4096
+)
+
+type parserState int
+
+const (
+	ParsingStatusLine     parserState = 0
+	ParsingHeaders        parserState = 1
+	ParsingBody           parserState = 2
+	ParsingBodyLength     parserState = 3
+	ParsingBodyUntilClose parserState = 4
+	ParsingChunks         parserState = 5
+	ParsingDone           parserState = 42
+)
+
+// ResponseFromReader parses a complete response, body included, from
+// reader. Interim 1xx responses before it are collected in Interim.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	response, err := ResponseHeadFromReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := response.ReadBody(); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ResponseHeadFromReader parses the final response's status line and
+// headers and stops before the body, which is then read with ReadBody or
+// BodyReader. A response to HEAD has no body, whatever its headers say, so
+// its body must not be read.
+func ResponseHeadFromReader(reader io.Reader) (*Response, error) {
+	response := &Response{
+		state:    ParsingStatusLine,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		Body:     make([]byte, 0),
+		reader:   reader,
+		buf:      make([]byte, parseBufferSize),
+	}
+
+	if err := response.readUntil(ParsingBody); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ReadBody reads the rest of the body and returns it. It is safe to call
+// more than once.
+func (r *Response) ReadBody() ([]byte, error) {
+	if err := r.readUntil(ParsingDone); err != nil {
+		return nil, err
+	}
+
+	return r.Body, nil
+}
+
+// BodyReader streams the body as it arrives instead of collecting it in
+// Body. Trailers are filled in once it returns io.EOF. It can't be mixed
+// with ReadBody.
+func (r *Response) BodyReader() io.Reader {
+	return &bodyReader{response: r}
+}
+
+type bodyReader struct {
+	response *Response
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	r := b.response
+	for len(r.Body) == 0 {
+		if r.state == ParsingDone {
+			return 0, io.EOF
+		}
+
+		if err := r.advance(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.Body)
+	r.Body = r.Body[n:]
+	return n, nil
+}
+
+func (r *Response) readUntil(target parserState) error {
+	for r.state < target {
+		if err := r.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance parses what has been buffered and reads more from the reader
+// when that isn't enough to make progress.
+func (r *Response) advance() error {
+	prevState := r.state
+	bytesParsed, err := r.parse(r.buf[:r.readToIndex])
+	if err != nil {
+		return err
+	}
+
+	copy(r.buf, r.buf[bytesParsed:r.readToIndex])
+	r.readToIndex -= bytesParsed
+	if bytesParsed > 0 || r.state != prevState {
+		return nil
+	}
+
+	if r.readToIndex >= len(r.buf) {
+		newBuf := make([]byte, len(r.buf)*2)
+		copy(newBuf, r.buf)
+		r.buf = newBuf
+	}
+
+	bytesRead, err := r.reader.Read(r.buf[r.readToIndex:])
+	r.readToIndex += bytesRead
+	if err != nil {
+		if errors.Is(err, io.EOF) && bytesRead > 0 {
+			return nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			if r.state == ParsingBodyUntilClose {
+				r.state = ParsingDone
+				return nil
+			}
+
+			return fmt.Errorf(
+				"incomplete response, in state: %d: %w",
+				r.state,
+				io.ErrUnexpectedEOF,
+			)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+	for r.state != ParsingDone {
+		prevState := r.state
+		n, err := r.parseSingle(data[totalBytesParsed:])
+		if err != nil {
+			return 0, err
+		}
+
+		totalBytesParsed += n
+		if n == 0 && r.state == prevState {
+			break
+		}
+
+		// Stop at the body so a head-only parse leaves it unread.
+		if r.state == ParsingBody {
+			break
+		}
+	}
+	return totalBytesParsed, nil
+}
+
+func (r *Response) parseSingle(data []byte) (int, error) {
+	switch r.state {
+	case ParsingStatusLine:
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			return 0, nil
+		}
+
+		responseLine, err := responseLineFromString(string(data[:idx]))
+		if err != nil {
+			return 0, err
+		}
+
+		r.ResponseLine = *responseLine
+		r.state = ParsingHeaders
+		return idx + len(crlf), nil
+	case ParsingHeaders:
+		n, done, err := r.Headers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if done {
+			r.endHead()
+		}
+		return n, nil
+	case ParsingBody:
+		return 0, r.startBody()
+	case ParsingBodyLength:
+		n := min(len(data), r.bodyRemaining)
+		r.Body = append(r.Body, data[:n]...)
+		r.bodyRemaining -= n
+		if r.bodyRemaining == 0 {
+			r.state = ParsingDone
+		}
+		return n, nil
+	case ParsingBodyUntilClose:
+		r.Body = append(r.Body, data...)
+		return len(data), nil
+	case ParsingChunks:
+		n, chunk, done, err := r.chunks.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+
+		r.Body = append(r.Body, chunk...)
+		if done {
+			r.state = ParsingDone
+		}
+		return n, nil
+	case ParsingDone:
+		return 0, fmt.Errorf("trying to read data in Done state")
+	default:
+		return 0, fmt.Errorf("unknown status %v", r.state)
+	}
+}
+
+// endHead finishes a response head. An interim response is set aside and
+// parsing starts over for the next one; 101 Switching Protocols is final,
+// since what follows it is no longer HTTP/1.1.
+func (r *Response) endHead() {
+	code := r.ResponseLine.StatusCode
+	if code >= 100 && code < 200 && code != SwitchingProtocols {
+		r.Interim = append(r.Interim, InterimResponse{
+			ResponseLine: r.ResponseLine,
+			Headers:      r.Headers,
+		})
+		r.ResponseLine = ResponseLine{}
+		r.Headers = headers.NewHeaders()
+		r.state = ParsingStatusLine
+		return
+	}
+
+	r.state = ParsingBody
+}
+
+// startBody works out how the body is delimited: 1xx, 204 and 304
+// responses have none, then chunked encoding, Content-Length and finally
+// the end of the connection are used in that order.
+func (r *Response) startBody() error {
+	code := r.ResponseLine.StatusCode
+	if code < 200 || code == NoContent || code == NotModified {
+		r.state = ParsingDone
+		return nil
+	}
+
+	if te, ok := r.Headers.Get("Transfer-Encoding"); ok {
+		codings := strings.Split(te, ",")
+		if strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			r.chunks = chunked.NewParser(r.Trailers)
+			r.state = ParsingChunks
+		} else {
+			r.state = ParsingBodyUntilClose
+		}
+		return nil
+	}
+
+	if cl, ok := r.Headers.Get("Content-Length"); ok {
+		length, ok := r.Headers.ContentLength()
+		if !ok {
+			return fmt.Errorf("invalid Content-Length: %s", cl)
+		}
+
+		r.bodyRemaining = int(length)
+		r.state = ParsingBodyLength
+		if length == 0 {
+			r.state = ParsingDone
+		}
+		return nil
+	}
+
+	r.state = ParsingBodyUntilClose
+	return nil
+}
+
+func responseLineFromString(str string) (*ResponseLine, error) {
+	version, rest, ok := strings.Cut(str, " ")
+	if !ok {
+		return nil, fmt.Errorf("poorly formatted status line: %s", str)
+	}
+
+	httpPart, versionNumber, ok := strings.Cut(version, "/")
+	if !ok || httpPart != "HTTP" || (versionNumber != "1.1" && versionNumber != "1.0") {
+		return nil, fmt.Errorf("unrecognized HTTP-version: %s", str)
+	}
+
+	code, reason, _ := strings.Cut(rest, " ")
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || len(code) != 3 || statusCode < 100 {
+		return nil, fmt.Errorf("invalid status code: %s", str)
+	}
+
+	return &ResponseLine{
+		HttpVersion:  versionNumber,
+		StatusCode:   StatusCode(statusCode),
+		ReasonPhrase: reason,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowReader returns at most n bytes per Read, like a network connection
+// delivering a response in pieces.
+type slowReader struct {
+	data string
+	pos  int
+	n    int
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if s.pos >= len(s.data) {
+		return 0, io.EOF
+	}
+
+	end := min(s.pos+s.n, s.pos+len(p), len(s.data))
+	n := copy(p, s.data[s.pos:end])
+	s.pos += n
+	return n, nil
+}
+
+func TestResponseFromReader(t *testing.T) {
+	// Test: Content-Length body
+	r, err := ResponseFromReader(&slowReader{
+		data: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		n:    3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ResponseLine{HttpVersion: "1.1", StatusCode: Ok, ReasonPhrase: "OK"}, r.ResponseLine)
+	assert.Equal(t, "text/plain", r.Headers["content-type"])
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Chunked body with trailers
+	r, err = ResponseFromReader(&slowReader{
+		data: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\n" +
+			"5;name=value\r\nhello\r\n7\r\n, world\r\n0\r\nX-Checksum: abc\r\n\r\n",
+		n: 4,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers["x-checksum"])
+
+	// Test: Body delimited by the end of the connection
+	r, err = ResponseFromReader(&slowReader{data: "HTTP/1.0 200 OK\r\n\r\nuntil close", n: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.ResponseLine.HttpVersion)
+	assert.Equal(t, "until close", string(r.Body))
+
+	// Test: Interim responses come before the final one
+	r, err = ResponseFromReader(&slowReader{
+		data: "HTTP/1.1 100 Continue\r\n\r\n" +
+			"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+			"HTTP/1.1 204 No Content\r\n\r\n",
+		n: 7,
+	})
+	require.NoError(t, err)
+	require.Len(t, r.Interim, 2)
+	assert.Equal(t, Continue, r.Interim[0].ResponseLine.StatusCode)
+	assert.Equal(t, "</style.css>; rel=preload", r.Interim[1].Headers["link"])
+	assert.Equal(t, NoContent, r.ResponseLine.StatusCode)
+	assert.Empty(t, r.Body)
+
+	// Test: 304 has no body even with a Content-Length
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 304 Not Modified\r\nContent-Length: 50\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+
+	// Test: Truncated bodies and malformed status lines
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 50\r\n\r\nshort"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = ResponseFromReader(strings.NewReader("HTTP/2 200 OK\r\n\r\n"))
+	require.Error(t, err)
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 20 OK\r\n\r\n"))
+	require.Error(t, err)
+}
+
+func TestResponseBodyReader(t *testing.T) {
+	r, err := ResponseHeadFromReader(&slowReader{
+		data: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"a\r\n0123456789\r\n6\r\nabcdef\r\n0\r\nX-Done: yes\r\n\r\n",
+		n: 3,
+	})
+	require.NoError(t, err)
+	_, ok := r.Trailers.Get("X-Done")
+	assert.False(t, ok)
+
+	body, err := io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", string(body))
+	assert.Equal(t, "yes", r.Trailers["x-done"])
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	require.NoError(t, w.WriteStatusLine(NotFound))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.Write([]byte("nothing to see here"))
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+
+	r, err := ResponseFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, NotFound, r.ResponseLine.StatusCode)
+	assert.Equal(t, "Not Found", r.ResponseLine.ReasonPhrase)
+	assert.Equal(t, "nothing to see here", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers["x-checksum"])
+}
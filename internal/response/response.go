@@ -10,24 +10,55 @@ import (
 type StatusCode int
 
 const (
+	Continue            StatusCode = 100
+	SwitchingProtocols  StatusCode = 101
+	EarlyHints          StatusCode = 103
 	Ok                  StatusCode = 200
+	NoContent           StatusCode = 204
+	PartialContent      StatusCode = 206
+	MovedPermanently    StatusCode = 301
+	NotModified         StatusCode = 304
 	BadRequest          StatusCode = 400
+	Unauthorized        StatusCode = 401
+	NotFound            StatusCode = 404
+	MethodNotAllowed    StatusCode = 405
+	PreconditionFailed  StatusCode = 412
+	PayloadTooLarge     StatusCode = 413
+	UnsupportedMedia    StatusCode = 415
+	RangeNotSatisfiable StatusCode = 416
+	ExpectationFailed   StatusCode = 417
 	InternalServerError StatusCode = 500
+	BadGateway          StatusCode = 502
+	GatewayTimeout      StatusCode = 504
 )
 
+var reasonPhrases = map[StatusCode]string{
+	Continue:            "Continue",
+	SwitchingProtocols:  "Switching Protocols",
+	EarlyHints:          "Early Hints",
+	Ok:                  "OK",
+	NoContent:           "No Content",
+	PartialContent:      "Partial Content",
+	MovedPermanently:    "Moved Permanently",
+	NotModified:         "Not Modified",
+	BadRequest:          "Bad Request",
+	Unauthorized:        "Unauthorized",
+	NotFound:            "Not Found",
+	MethodNotAllowed:    "Method Not Allowed",
+	PreconditionFailed:  "Precondition Failed",
+	PayloadTooLarge:     "Content Too Large",
+	UnsupportedMedia:    "Unsupported Media Type",
+	RangeNotSatisfiable: "Range Not Satisfiable",
+	ExpectationFailed:   "Expectation Failed",
+	InternalServerError: "Internal Server Error",
+	BadGateway:          "Bad Gateway",
+	GatewayTimeout:      "Gateway Timeout",
+}
+
 func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	statusCodeResponses := make(map[StatusCode]string)
 	templateString := "HTTP/1.1 %d %s\r\n"
-	statusCodeResponses[Ok] = fmt.Sprintf(templateString, Ok, "OK")
-	statusCodeResponses[BadRequest] = fmt.Sprintf(templateString, BadRequest, "Bad Request")
-	statusCodeResponses[InternalServerError] = fmt.Sprintf(
-		templateString,
-		InternalServerError,
-		"Internal Server Error",
-	)
-
-	if resp, ok := statusCodeResponses[statusCode]; ok {
-		_, err := w.Write([]byte(resp))
+	if reason, ok := reasonPhrases[statusCode]; ok {
+		_, err := fmt.Fprintf(w, templateString, statusCode, reason)
 		return err
 	}
 
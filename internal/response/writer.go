@@ -1,24 +1,61 @@
 package response
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
 )
 
 type writerState int
 
 const (
-	StatusLine writerState = 0
-	Headers    writerState = 1
-	Body       writerState = 2
-	Done       writerState = 42
+	StatusLine  writerState = 0
+	Headers     writerState = 1
+	Body        writerState = 2
+	ChunkedBody writerState = 3
+	Trailers    writerState = 4
+	Done        writerState = 42
 )
 
+// DefaultFramingThreshold is the number of body bytes an auto framing
+// writer buffers before it gives up on Content-Length and starts streaming.
+const DefaultFramingThreshold = 4096
+
+type flusher interface {
+	Flush() error
+}
+
 type Writer struct {
-	state  writerState
-	Writer io.Writer
+	state      writerState
+	Writer     io.Writer
+	request    *request.Request
+	statusCode StatusCode
+	headers    headers.Headers
+	trailers   []string
+
+	// chunked is set when the body goes out chunked on the wire, and
+	// declaredChunked when the handler itself asked for chunked encoding
+	// and so writes the body with WriteChunkedBody.
+	chunked         bool
+	declaredChunked bool
+
+	// filters see the response on its way out; body holds the head of the
+	// chain of body filters and closers the writers in it, outermost first.
+	filters []Filter
+	body    io.Writer
+	closers []io.Closer
+
+	// Auto framing: headers without framing information are held in
+	// pending while the body is collected in buf, until either the handler
+	// finishes or buf grows past threshold.
+	autoFraming bool
+	threshold   int
+	pending     headers.Headers
+	buf         bytes.Buffer
 }
 
 func NewWriter(w io.Writer) *Writer {
@@ -28,13 +65,205 @@ func NewWriter(w io.Writer) *Writer {
 	}
 }
 
+// EnableAutoFraming lets handlers write a body without declaring its
+// framing. When the headers carry neither Content-Length nor
+// Transfer-Encoding, up to threshold body bytes are buffered. A body that
+// is complete by then is sent with a Content-Length; a longer one is
+// streamed with chunked encoding, or delimited by closing the connection
+// for HTTP/1.0 clients.
+func (w *Writer) EnableAutoFraming(threshold int) {
+	w.autoFraming = true
+	w.threshold = threshold
+}
+
+// WriteStatusLine records the final status code. The status line goes out
+// together with the headers.
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.state != StatusLine {
 		return fmt.Errorf("writer in incorrect state, state %d", w.state)
 	}
 
-	defer func() { w.state = Headers }()
-	return WriteStatusLine(w.Writer, statusCode)
+	w.statusCode = statusCode
+	w.state = Headers
+	return nil
+}
+
+// SetRequest tells the writer which request it is answering, so that rules
+// that depend on the request, like never sending a body in reply to HEAD,
+// are applied without the handler having to know about them.
+func (w *Writer) SetRequest(req *request.Request) {
+	w.request = req
+}
+
+// bodyAllowed reports whether the response may carry body bytes. Responses
+// to HEAD and 204 and 304 responses never do, even when the handler writes
+// one; their headers still describe the body a GET would have received.
+func (w *Writer) bodyAllowed() bool {
+	if w.request != nil && w.request.RequestLine.Method == "HEAD" {
+		return false
+	}
+
+	return w.statusAllowsBody()
+}
+
+func (w *Writer) statusAllowsBody() bool {
+	return w.statusCode != NoContent && w.statusCode != NotModified
+}
+
+// prohibitedTrailers are the fields RFC 9110 section 6.5.1 rules out as
+// trailers because recipients need them before the body: framing, routing,
+// request modifiers, authentication, response control data and fields that
+// describe how to process the content.
+var prohibitedTrailers = map[string]bool{
+	"transfer-encoding":   true,
+	"content-length":      true,
+	"host":                true,
+	"cache-control":       true,
+	"expect":              true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"range":               true,
+	"te":                  true,
+	"if-match":            true,
+	"if-none-match":       true,
+	"if-modified-since":   true,
+	"if-unmodified-since": true,
+	"if-range":            true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"www-authenticate":    true,
+	"proxy-authenticate":  true,
+	"set-cookie":          true,
+	"cookie":              true,
+	"age":                 true,
+	"date":                true,
+	"expires":             true,
+	"location":            true,
+	"retry-after":         true,
+	"vary":                true,
+	"warning":             true,
+	"content-encoding":    true,
+	"content-type":        true,
+	"content-range":       true,
+	"trailer":             true,
+}
+
+// DeclareTrailer announces trailer fields the handler will send with
+// WriteTrailers. It must be called before the headers are committed; the
+// writer then adds the Trailer header itself. Fields that may not appear
+// in a trailer section are rejected.
+func (w *Writer) DeclareTrailer(names ...string) error {
+	if w.state > Body || (w.state == Body && w.pending == nil) {
+		return fmt.Errorf("trailers must be declared before the headers are written")
+	}
+
+	for _, name := range names {
+		if err := w.declareTrailer(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) declareTrailer(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if prohibitedTrailers[name] {
+		return fmt.Errorf("field not allowed in trailers: %s", name)
+	}
+
+	if name != "" && !w.trailerDeclared(name) {
+		w.trailers = append(w.trailers, name)
+	}
+	return nil
+}
+
+func (w *Writer) trailerDeclared(name string) bool {
+	for _, declared := range w.trailers {
+		if declared == name {
+			return true
+		}
+	}
+	return false
+}
+
+// trailersAccepted reports whether trailers will reach the client: it has
+// to be an HTTP/1.1 client that said so with TE: trailers.
+func (w *Writer) trailersAccepted() bool {
+	if w.request == nil {
+		return true
+	}
+
+	if w.isHTTP10() {
+		return false
+	}
+
+	te, ok := w.request.Headers.Get("TE")
+	if !ok {
+		return false
+	}
+
+	for _, coding := range strings.Split(te, ",") {
+		coding, _, _ = strings.Cut(coding, ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "trailers") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Writer) isHTTP10() bool {
+	return w.request != nil && w.request.RequestLine.HttpVersion == "1.0"
+}
+
+// WriteInformational sends an interim 1xx response with its own headers.
+// Any number of interim responses may precede the final status line, e.g.
+// 103 Early Hints carrying Link: </app.css>; rel=preload. Each one is
+// flushed straight away so the client can act on it while the final
+// response is still being prepared. HTTP/1.0 clients don't understand
+// interim responses, so nothing is sent to them.
+func (w *Writer) WriteInformational(statusCode StatusCode, h headers.Headers) error {
+	if w.state != StatusLine {
+		return fmt.Errorf("writer in incorrect state, state %d", w.state)
+	}
+
+	// 101 Switching Protocols hands the connection over to another
+	// protocol, which this writer has no way to speak.
+	if statusCode < 100 || statusCode > 199 || statusCode == SwitchingProtocols {
+		return fmt.Errorf("not an informational status code: %d", statusCode)
+	}
+
+	if w.isHTTP10() {
+		return nil
+	}
+
+	if err := WriteStatusLine(w.Writer, statusCode); err != nil {
+		return err
+	}
+
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+
+	if err := WriteHeaders(w.Writer, h); err != nil {
+		return err
+	}
+
+	return w.flush()
+}
+
+// WriteContinue sends an interim 100 Continue response, telling a client
+// that sent Expect: 100-continue to go ahead with the body.
+func (w *Writer) WriteContinue() error {
+	return w.WriteInformational(Continue, nil)
+}
+
+// flush pushes buffered output to the client when the underlying writer
+// buffers, so that interim responses are not held back.
+func (w *Writer) flush() error {
+	if f, ok := w.Writer.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
 }
 
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
@@ -42,57 +271,368 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 		return fmt.Errorf("writer in incorrect state, state %d", w.state)
 	}
 
-	defer func() { w.state = Body }()
-	return WriteHeaders(w.Writer, headers)
+	w.state = Body
+	w.declaredChunked = isChunked(headers)
+	if w.autoFraming && !hasFraming(headers) && w.statusAllowsBody() {
+		w.pending = headers
+		return nil
+	}
+
+	return w.commit(headers, nil)
 }
 
-func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.state != Body {
+// commit runs the filters over the response head and writes the status
+// line and the final headers. body is the complete body when auto framing
+// buffered all of it.
+func (w *Writer) commit(h headers.Headers, body []byte) error {
+	w.pending = nil
+	head := &Head{StatusCode: w.statusCode, Headers: h, Body: body}
+	for i := len(w.filters) - 1; i >= 0; i-- {
+		w.filters[i].Header(head)
+	}
+
+	w.statusCode = head.StatusCode
+	h = head.Headers
+	w.headers = h
+	w.chunked = isChunked(h)
+	// A Trailer header set by hand counts as a declaration; prohibited
+	// names in it are dropped.
+	if trailer, ok := h.Get("Trailer"); ok {
+		for _, name := range strings.Split(trailer, ",") {
+			w.declareTrailer(name)
+		}
+	}
+
+	h.Delete("Trailer")
+	if w.chunked && len(w.trailers) > 0 && w.trailersAccepted() {
+		h.Replace("Trailer", strings.Join(w.trailers, ", "))
+	}
+
+	switch w.statusCode {
+	case NoContent:
+		h.Delete("Content-Length")
+		h.Delete("Transfer-Encoding")
+	case NotModified:
+		h.Delete("Transfer-Encoding")
+	}
+
+	if err := WriteStatusLine(w.Writer, w.statusCode); err != nil {
+		return err
+	}
+	return WriteHeaders(w.Writer, h)
+}
+
+// Write implements io.Writer. Unlike WriteBody it may be called any number
+// of times, and it frames each write according to the declared headers:
+// as a chunk under Transfer-Encoding: chunked, as raw bytes otherwise, or
+// into the auto framing buffer while the headers are still pending. Writing
+// before the status line or headers implies 200 OK and no extra headers.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state == StatusLine {
+		if err := w.WriteStatusLine(Ok); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.state == Headers {
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.state != Body && w.state != ChunkedBody {
 		return 0, fmt.Errorf("writer in incorrect state, state %d", w.state)
 	}
 
-	defer func() { w.state = Done }()
-	return w.Writer.Write(p)
+	return w.bodyWriter().Write(p)
 }
 
-func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+// bodyWriter returns the head of the filter chain that body bytes pass
+// through before writeFramed puts them on the wire. The chain is built on
+// the first write so that body filters see the headers the handler set.
+func (w *Writer) bodyWriter() io.Writer {
+	if w.body != nil {
+		return w.body
+	}
+
+	var out io.Writer = framedWriter{w}
+	head := &Head{StatusCode: w.statusCode, Headers: w.pending}
+	if head.Headers == nil {
+		head.Headers = w.headers
+	}
+
+	for _, f := range w.filters {
+		bf, ok := f.(BodyFilter)
+		if !ok {
+			continue
+		}
+
+		wc := bf.Body(out, head)
+		w.closers = append([]io.Closer{wc}, w.closers...)
+		out = wc
+	}
+
+	w.body = out
+	return out
+}
+
+type framedWriter struct {
+	w *Writer
+}
+
+func (f framedWriter) Write(p []byte) (int, error) {
+	return f.w.writeFramed(p)
+}
+
+// writeFramed puts body bytes on the wire: into the auto framing buffer
+// while the headers are pending, as a chunk under chunked encoding, or as
+// they are otherwise.
+func (w *Writer) writeFramed(p []byte) (int, error) {
+	if w.pending != nil {
+		w.buf.Write(p)
+		if w.buf.Len() > w.threshold {
+			if err := w.startStreaming(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+
+	if len(p) == 0 || !w.bodyAllowed() {
+		return len(p), nil
+	}
+
+	if !w.chunked {
+		return w.Writer.Write(p)
+	}
+
 	var buf []byte
 	buf = fmt.Appendf(buf, "%x\r\n", len(p))
-	chunkStartLen, err := w.Writer.Write(buf)
-	if err != nil {
+	if _, err := w.Writer.Write(buf); err != nil {
 		return 0, err
 	}
-	chunkBodyLen, err := w.Writer.Write(p)
+
+	n, err := w.Writer.Write(p)
 	if err != nil {
-		return 0, err
+		return n, err
+	}
+
+	_, err = w.Writer.Write([]byte("\r\n"))
+	return n, err
+}
+
+// startStreaming commits the pending headers once the body has outgrown
+// the buffer and sends what was buffered so far.
+func (w *Writer) startStreaming() error {
+	h := w.pending
+	if w.isHTTP10() {
+		h.Replace("Connection", "close")
+	} else {
+		h.Replace("Transfer-Encoding", "chunked")
+	}
+
+	if err := w.commit(h, nil); err != nil {
+		return err
 	}
 
-	chunkEndLen, err := w.Writer.Write([]byte("\r\n"))
+	buffered := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	_, err := w.writeFramed(buffered)
+	return err
+}
+
+// WriteBody writes p as the whole body and completes the response.
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	if w.state != Body {
+		return 0, fmt.Errorf("writer in incorrect state, state %d", w.state)
+	}
+
+	if w.declaredChunked {
+		return 0, fmt.Errorf("body declared as chunked, use WriteChunkedBody")
+	}
+
+	n, err := w.bodyWriter().Write(p)
 	if err != nil {
-		return 0, err
+		return n, err
 	}
-	return chunkStartLen + chunkBodyLen + chunkEndLen, nil
+
+	_, err = w.endBody(nil)
+	return n, err
 }
 
-func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	var buf []byte
-	buf = fmt.Appendf(buf, "%x\r\n", 0)
-	chunkStartLen, err := w.Writer.Write(buf)
+// Close completes the response: a buffered body is sent with its
+// Content-Length, a chunked body gets its terminating chunk, and a handler
+// that wrote nothing at all gets an empty 200 OK. The server calls Close
+// after every handler returns; calling it again is harmless.
+func (w *Writer) Close() error {
+	switch w.state {
+	case StatusLine:
+		if err := w.WriteStatusLine(Ok); err != nil {
+			return err
+		}
+		fallthrough
+	case Headers:
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return err
+		}
+	}
+
+	switch w.state {
+	case Body, ChunkedBody:
+		_, err := w.endBody(nil)
+		return err
+	case Trailers:
+		return fmt.Errorf("response closed while writing trailers")
+	}
+	return nil
+}
+
+// endBody flushes the filters and finishes the body. A body still held by
+// auto framing goes out with a Content-Length, unless there are handler
+// trailers for a client that accepts them, in which case it is switched to
+// chunked. A chunked body ends with the last chunk and the trailer
+// section, to which trailer filters add their fields. It returns the
+// number of bytes written after the body.
+func (w *Writer) endBody(trailers headers.Headers) (int, error) {
+	w.bodyWriter()
+	for _, c := range w.closers {
+		if err := c.Close(); err != nil {
+			return 0, err
+		}
+	}
+	w.closers = nil
+
+	if w.pending != nil {
+		if len(trailers) == 0 || !w.trailersAccepted() {
+			h := w.pending
+			body := w.buf.Bytes()
+			w.buf = bytes.Buffer{}
+			h.Replace("Content-Length", fmt.Sprintf("%d", len(body)))
+			if err := w.commit(h, body); err != nil {
+				return 0, err
+			}
+
+			w.state = Done
+			if _, err := w.writeFramed(body); err != nil {
+				return 0, err
+			}
+			return 0, nil
+		}
+
+		if err := w.startStreaming(); err != nil {
+			return 0, err
+		}
+	}
+
+	if !w.chunked || !w.bodyAllowed() {
+		w.state = Done
+		return 0, nil
+	}
+
+	if trailers == nil {
+		trailers = headers.NewHeaders()
+	}
+
+	for _, f := range w.filters {
+		if tf, ok := f.(TrailerFilter); ok {
+			tf.Trailers(trailers)
+		}
+	}
+
+	if !w.trailersAccepted() {
+		trailers = headers.NewHeaders()
+	}
+
+	// First, write the final chunk of size 0
+	n, err := w.Writer.Write([]byte("0\r\n"))
 	if err != nil {
+		return n, err
+	}
+
+	w.state = Trailers
+	cw := &countingWriter{w: w.Writer, n: n}
+	if err := WriteHeaders(cw, trailers); err != nil {
+		return cw.n, err
+	}
+
+	w.state = Done
+	return cw.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// WriteChunkedBody writes p through to the body as a chunk. The headers
+// must have declared Transfer-Encoding: chunked. An empty p writes nothing,
+// since a zero sized chunk would end the body. It returns the number of
+// bytes of p written.
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if err := w.checkChunkedState(); err != nil {
 		return 0, err
 	}
-	chunkBodyLen, err := w.Writer.Write([]byte("\r\n"))
-	if err != nil {
+
+	w.state = ChunkedBody
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return w.bodyWriter().Write(p)
+}
+
+// WriteChunkedBodyDone ends a chunked body that has no trailers of its
+// own and returns the number of bytes written to end it.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if err := w.checkChunkedState(); err != nil {
 		return 0, err
 	}
-	return chunkStartLen + chunkBodyLen, nil
+	return w.endBody(nil)
+}
+
+func (w *Writer) checkChunkedState() error {
+	if w.state != Body && w.state != ChunkedBody {
+		return fmt.Errorf("writer in incorrect state, state %d", w.state)
+	}
+
+	if !w.declaredChunked {
+		return fmt.Errorf("chunked body written without Transfer-Encoding: chunked")
+	}
+
+	return nil
+}
+
+// hasFraming reports whether the headers already say how the body is
+// delimited.
+func hasFraming(h headers.Headers) bool {
+	_, hasLength := h.Get("Content-Length")
+	_, hasEncoding := h.Get("Transfer-Encoding")
+	return hasLength || hasEncoding
+}
+
+// isChunked reports whether chunked is the final transfer coding.
+func isChunked(h headers.Headers) bool {
+	te, ok := h.Get("Transfer-Encoding")
+	if !ok {
+		return false
+	}
+
+	codings := strings.Split(te, ",")
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
 }
 
 func WriteHeaders(w io.Writer, headers headers.Headers) error {
-	for k, v := range headers {
-		_, err := fmt.Fprintf(w, "%s: %s\r\n", k, v)
-		if err != nil {
-			return err
+	for k := range headers {
+		for _, v := range headers.Values(k) {
+			_, err := fmt.Fprintf(w, "%s: %s\r\n", k, v)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -100,12 +640,80 @@ func WriteHeaders(w io.Writer, headers headers.Headers) error {
 	return err
 }
 
+// WriteTrailers ends the body with the last chunk followed by the trailer
+// fields in h. Every field must have been declared with DeclareTrailer.
+// Clients that didn't ask for trailers get the body ended without them.
+// While auto framing still holds the body, the response is switched to
+// chunked so the trailers can follow it, unless they would be dropped
+// anyway.
 func (w *Writer) WriteTrailers(h headers.Headers) error {
-	// First, write the final chunk of size 0
-	_, err := w.Writer.Write([]byte("0\r\n"))
-	if err != nil {
-		return err
+	for name := range h {
+		if prohibitedTrailers[name] {
+			return fmt.Errorf("field not allowed in trailers: %s", name)
+		}
+
+		if !w.trailerDeclared(name) {
+			return fmt.Errorf("trailer not declared: %s", name)
+		}
 	}
 
-	return WriteHeaders(w.Writer, h)
+	switch {
+	case w.pending != nil || w.chunked:
+		// Either still undecided, or switched to chunked by auto framing
+		// or a filter.
+		if w.state != Body && w.state != ChunkedBody {
+			return fmt.Errorf("writer in incorrect state, state %d", w.state)
+		}
+	default:
+		if err := w.checkChunkedState(); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.endBody(h)
+	return err
+}
+
+// Committed reports whether the status line and headers have gone out, so
+// that the response can no longer be replaced.
+func (w *Writer) Committed() bool {
+	return w.state > Headers && w.pending == nil
+}
+
+// Reset throws away a response that hasn't been committed, including the
+// body auto framing has buffered, so that a different one can be written
+// in its place. Filters stay in place; those implementing ResettableFilter
+// are reset. It fails once the head has gone out.
+func (w *Writer) Reset() error {
+	if w.Committed() {
+		return fmt.Errorf("response already committed, state %d", w.state)
+	}
+
+	w.state = StatusLine
+	w.statusCode = 0
+	w.headers = nil
+	w.trailers = nil
+	w.chunked = false
+	w.declaredChunked = false
+	w.body = nil
+	w.closers = nil
+	w.pending = nil
+	w.buf = bytes.Buffer{}
+	for _, f := range w.filters {
+		if rf, ok := f.(ResettableFilter); ok {
+			rf.Reset()
+		}
+	}
+	return nil
+}
+
+// Abort gives up on a response that can't be completed, such as when the
+// source of a streamed body fails after the headers went out. Nothing more
+// is written, so the body stays truncated where the client can tell from
+// its framing, and Close does nothing. The connection must not be reused.
+func (w *Writer) Abort() {
+	w.state = Done
+	w.pending = nil
+	w.buf = bytes.Buffer{}
+	w.closers = nil
 }
@@ -0,0 +1,387 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInformational(t *testing.T) {
+	// Test: Several interim responses before the final one
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	hints := headers.NewHeaders()
+	hints.Set("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteContinue())
+	require.NoError(t, w.WriteInformational(EarlyHints, hints))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(
+		t,
+		"HTTP/1.1 100 Continue\r\n\r\n"+
+			"HTTP/1.1 103 Early Hints\r\nlink: </style.css>; rel=preload; as=style\r\n\r\n"+
+			"HTTP/1.1 200 OK\r\n\r\n",
+		buf.String(),
+	)
+
+	// Test: Interim responses are not allowed after the final status line
+	require.Error(t, w.WriteInformational(EarlyHints, hints))
+
+	// Test: Non 1xx status codes are rejected
+	w = NewWriter(&buf)
+	require.Error(t, w.WriteInformational(Ok, nil))
+	require.Error(t, w.WriteInformational(101, nil))
+}
+
+func TestBodySuppression(t *testing.T) {
+	// Test: HEAD keeps the headers but drops the body
+	req, err := request.RequestFromReader(
+		strings.NewReader("HEAD / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"),
+	)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetRequest(req)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Contains(t, buf.String(), "content-length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "hello")
+
+	// Test: 204 drops the body and the framing headers
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(NoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), "content-length")
+	assert.NotContains(t, buf.String(), "hello")
+
+	// Test: 304 drops chunked bodies and trailers
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(NotModified))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n\r\n", buf.String())
+}
+
+func TestChunkedWriterState(t *testing.T) {
+	chunkedHeaders := func() headers.Headers {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		return h
+	}
+
+	// Test: Chunks followed by trailers
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.DeclareTrailer("X-Count"))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders()))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Count", "1")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.Contains(t, buf.String(), "trailer: x-count\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n5\r\nhello\r\n0\r\nx-count: 1\r\n\r\n"))
+
+	// Test: Nothing may follow the end of the body
+	_, err = w.WriteChunkedBody([]byte("more"))
+	require.Error(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.Error(t, err)
+	require.Error(t, w.WriteTrailers(trailers))
+
+	// Test: The terminating chunk is only written once
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders()))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.Error(t, err)
+	assert.Equal(t, 1, strings.Count(buf.String(), "0\r\n\r\n"))
+
+	// Test: Chunks before the headers are rejected
+	w = NewWriter(&buf)
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.Error(t, err)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.Error(t, err)
+
+	// Test: Chunks require Transfer-Encoding: chunked
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.Error(t, err)
+
+	// Test: WriteBody and chunks can't be mixed
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders()))
+	_, err = w.WriteBody([]byte("hello"))
+	require.Error(t, err)
+}
+
+func TestAutoFraming(t *testing.T) {
+	newRequest := func(line string) *request.Request {
+		req, err := request.RequestFromReader(strings.NewReader(line + "\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		return req
+	}
+
+	// Test: A body within the threshold gets a Content-Length
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\nhello", buf.String())
+
+	// Test: A body over the threshold switches to chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	w.SetRequest(newRequest("GET / HTTP/1.1"))
+	_, err = w.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("!"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(
+		t,
+		"HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\nb\r\nhello world\r\n1\r\n!\r\n0\r\n\r\n",
+		buf.String(),
+	)
+
+	// Test: HTTP/1.0 clients get a close delimited body instead
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	w.SetRequest(newRequest("GET / HTTP/1.0"))
+	_, err = w.Write([]byte("hello world!"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nconnection: close\r\n\r\nhello world!", buf.String())
+
+	// Test: Declared framing is left alone
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(12)))
+	assert.Contains(t, buf.String(), "content-length: 12\r\n")
+	_, err = w.WriteBody([]byte("hello world!"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello world!"))
+
+	// Test: WriteBody with pending headers completes the response
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	require.NoError(t, w.WriteStatusLine(BadRequest))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.WriteBody([]byte("nope"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 400 Bad Request\r\ncontent-length: 4\r\n\r\nnope", buf.String())
+	require.NoError(t, w.Close())
+
+	// Test: HEAD still reports the length of the body it drops
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	w.SetRequest(newRequest("HEAD / HTTP/1.1"))
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\n", buf.String())
+
+	// Test: A handler that writes nothing gets an empty 200
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(8)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 0\r\n\r\n", buf.String())
+}
+
+func TestTrailers(t *testing.T) {
+	newRequest := func(extra string) *request.Request {
+		req, err := request.RequestFromReader(
+			strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n" + extra + "\r\n"),
+		)
+		require.NoError(t, err)
+		return req
+	}
+	chunkedHeaders := func() headers.Headers {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		return h
+	}
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+
+	// Test: Prohibited fields can't be declared
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.Error(t, w.DeclareTrailer("Content-Length"))
+	require.Error(t, w.DeclareTrailer("host"))
+
+	// Test: Undeclared and prohibited trailers are rejected
+	w = NewWriter(&buf)
+	w.SetRequest(newRequest("TE: trailers\r\n"))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders()))
+	require.Error(t, w.DeclareTrailer("X-Checksum"))
+	require.Error(t, w.WriteTrailers(trailers))
+	bad := headers.NewHeaders()
+	bad.Set("Content-Length", "5")
+	require.Error(t, w.WriteTrailers(bad))
+
+	// Test: Trailers are dropped for clients that didn't send TE: trailers
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetRequest(newRequest(""))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders()))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.NotContains(t, buf.String(), "trailer")
+	assert.NotContains(t, buf.String(), "x-checksum")
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+
+	// Test: Auto framing switches to chunked to deliver trailers
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(1024)
+	w.SetRequest(newRequest("TE: trailers\r\n"))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.Contains(t, buf.String(), "trailer: x-checksum\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "5\r\nhello\r\n0\r\nx-checksum: abc\r\n\r\n"))
+
+	// Test: Auto framing keeps Content-Length when trailers would be dropped
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(1024)
+	w.SetRequest(newRequest(""))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\nhello", buf.String())
+}
+
+func TestAbort(t *testing.T) {
+	// Test: An aborted chunked body has no last chunk
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableAutoFraming(4)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err := w.Write([]byte("partial body"))
+	require.NoError(t, err)
+	w.Abort()
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasSuffix(buf.String(), "c\r\npartial body\r\n"))
+
+	// Test: Trailers can end a body that auto framing switched to chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(4)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.Write([]byte("streamed body"))
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\nx-checksum: abc\r\n\r\n"))
+}
+
+type countingFilter struct {
+	n int
+}
+
+func (f *countingFilter) Header(head *Head) {
+	head.Headers.Replace("X-Body-Bytes", strconv.Itoa(f.n))
+}
+
+func (f *countingFilter) Body(dst io.Writer, head *Head) io.WriteCloser {
+	return f
+}
+
+func (f *countingFilter) Write(p []byte) (int, error) {
+	f.n += len(p)
+	return len(p), nil
+}
+
+func (f *countingFilter) Close() error { return nil }
+
+func (f *countingFilter) Reset() { f.n = 0 }
+
+func TestReset(t *testing.T) {
+	// Test: A held back response is replaced, and filters start over
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.EnableAutoFraming(64)
+	require.NoError(t, w.AddFilter(&countingFilter{}))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err := w.Write([]byte("partial"))
+	require.NoError(t, err)
+	assert.False(t, w.Committed())
+
+	require.NoError(t, w.Reset())
+	require.NoError(t, w.WriteStatusLine(BadGateway))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 502 Bad Gateway\r\n", buf.String()[:len("HTTP/1.1 502 Bad Gateway\r\n")])
+	assert.Contains(t, buf.String(), "x-body-bytes: 0\r\n")
+	assert.NotContains(t, buf.String(), "partial")
+
+	// Test: Committed responses can't be replaced
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.EnableAutoFraming(4)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.Write([]byte("partial body"))
+	require.NoError(t, err)
+	assert.True(t, w.Committed())
+	require.Error(t, w.Reset())
+}
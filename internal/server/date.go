@@ -0,0 +1,45 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+)
+
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+var currentDate atomic.Pointer[cachedDate]
+
+// dateValue returns now as an IMF-fixdate. The formatted value only changes
+// once a second, so it is reused until then.
+func dateValue(now time.Time) string {
+	unix := now.Unix()
+	if cached := currentDate.Load(); cached != nil && cached.unix == unix {
+		return cached.value
+	}
+
+	value := headers.FormatHTTPDate(now)
+	currentDate.Store(&cachedDate{unix: unix, value: value})
+	return value
+}
+
+// defaultHeaders is a response filter that adds the Date header, and the
+// Server header when a name is configured, to responses that lack them.
+type defaultHeaders struct {
+	serverName string
+}
+
+func (d defaultHeaders) Header(head *response.Head) {
+	if _, ok := head.Headers.Get("Date"); !ok {
+		head.Headers.Set("Date", dateValue(time.Now()))
+	}
+
+	if _, ok := head.Headers.Get("Server"); !ok && d.serverName != "" {
+		head.Headers.Set("Server", d.serverName)
+	}
+}
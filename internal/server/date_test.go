@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultHeaders(t *testing.T) {
+	// Test: Dates are IMF-fixdate in GMT
+	now := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.FixedZone("EST", -5*3600))
+	assert.Equal(t, "Sun, 06 Nov 1994 13:49:37 GMT", dateValue(now))
+	assert.Equal(t, "Sun, 06 Nov 1994 13:49:37 GMT", dateValue(now.Add(500*time.Millisecond)))
+	assert.Equal(t, "Sun, 06 Nov 1994 13:49:38 GMT", dateValue(now.Add(time.Second)))
+
+	// Test: Date and Server are added when missing
+	head := &response.Head{StatusCode: response.Ok, Headers: headers.NewHeaders()}
+	defaultHeaders{serverName: "httpfromtcp"}.Header(head)
+	_, ok := head.Headers.Get("Date")
+	assert.True(t, ok)
+	assert.Equal(t, "httpfromtcp", head.Headers["server"])
+
+	// Test: Handler values are kept and no Server is sent without a name
+	head.Headers = headers.NewHeaders()
+	head.Headers.Set("Date", "Sun, 06 Nov 1994 08:49:37 GMT")
+	defaultHeaders{}.Header(head)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", head.Headers["date"])
+	_, ok = head.Headers.Get("Server")
+	assert.False(t, ok)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"log/slog"
+
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/dump"
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithDigestVerification checks request bodies against the Content-Digest
+// or Repr-Digest the client sent, using the given algorithms in order of
+// preference. Mismatches, and digests using none of the algorithms, are
+// answered with 400 Bad Request and a Want-Content-Digest header listing
+// the algorithms the server accepts. When the handler reads the body
+// itself, as with Expect: 100-continue or WithStreamingBodies, that answer
+// replaces whatever the handler wrote, unless the handler had already
+// started sending its response.
+func WithDigestVerification(algs ...digest.Algorithm) Option {
+	return func(s *Server) {
+		s.digestAlgs = algs
+	}
+}
+
+// WithMaxBodySize rejects request bodies longer than n bytes with 413
+// Content Too Large. With WithRequestDecompression the limit also applies
+// to the decoded body.
+func WithMaxBodySize(n int) Option {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// WithRequestDecompression decodes gzip and deflate request bodies before
+// the handler sees them, so req.Body holds the decoded bytes. Bodies in any
+// other coding are answered with 415 Unsupported Media Type. Without
+// WithMaxBodySize, encoded bodies are limited to
+// request.DefaultMaxDecodedSize.
+func WithRequestDecompression() Option {
+	return func(s *Server) {
+		s.decompress = true
+	}
+}
+
+// WithStreamingBodies leaves reading the request body to the handler, with
+// req.ReadBody or req.BodyReader, so bodies can be streamed instead of
+// being held in memory. Failures reading the body, such as a body over
+// WithMaxBodySize, then reach the handler; the server answers them as it
+// would have up front unless the handler's response has already started
+// going out. Whatever the handler leaves unread is discarded after the
+// response.
+func WithStreamingBodies() Option {
+	return func(s *Server) {
+		s.streamBodies = true
+	}
+}
+
+// WithServerName sends name in the Server header of responses whose handler
+// didn't set one.
+func WithServerName(name string) Option {
+	return func(s *Server) {
+		s.serverName = name
+	}
+}
+
+// WithDump logs each connection's request and response in wire format to
+// logger at debug level, rendered with opts. The request is dumped as it
+// arrived, including requests that failed to parse. Nothing is recorded
+// while logger has debug disabled.
+func WithDump(logger *slog.Logger, opts ...dump.Option) Option {
+	return func(s *Server) {
+		s.dumpLogger = logger
+		s.dumpOpts = opts
+	}
+}
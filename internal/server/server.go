@@ -1,13 +1,19 @@
 package server
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"sync/atomic"
 
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/dump"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
 	"github.com/mgmaster24/httpfromtcp/internal/request"
 	"github.com/mgmaster24/httpfromtcp/internal/response"
 )
@@ -16,6 +22,14 @@ type Server struct {
 	listener net.Listener
 	handler  Handler
 	closed   atomic.Bool
+
+	digestAlgs   []digest.Algorithm
+	maxBodySize  int
+	decompress   bool
+	streamBodies bool
+	serverName   string
+	dumpLogger   *slog.Logger
+	dumpOpts     []dump.Option
 }
 
 type HandlerError struct {
@@ -35,9 +49,14 @@ func WriteResponse(w io.Writer, statusCode response.StatusCode, contentLen int)
 	}
 }
 
-type Handler func(w io.Writer, req *request.Request)
+// Handler answers a single request. The request body has already been read
+// into req.Body unless the client sent Expect: 100-continue or the server
+// streams bodies; in those cases the handler calls req.ReadBody or reads
+// req.BodyReader, which send the 100 Continue first, or rejects the upload
+// by writing a final response without reading the body.
+type Handler func(w *response.Writer, req *request.Request)
 
-func Serve(port int32, handler Handler) (*Server, error) {
+func Serve(port int32, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
@@ -47,6 +66,9 @@ func Serve(port int32, handler Handler) (*Server, error) {
 		listener: listener,
 		handler:  handler,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
 
 	go server.listen()
 
@@ -78,17 +100,137 @@ func (s *Server) listen() {
 
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	request, err := request.RequestFromReader(conn)
+	bw := bufio.NewWriter(conn)
+	defer func() {
+		err := bw.Flush()
+		if err != nil {
+			log.Printf("error writing the content to the connection. err: %e", err)
+		}
+	}()
+
+	var in io.Reader = conn
+	var out io.Writer = bw
+	if s.dumpLogger != nil && s.dumpLogger.Enabled(context.Background(), slog.LevelDebug) {
+		reqRec := dump.NewRecorder(nil, s.dumpOpts...)
+		respRec := dump.NewRecorder(bw, s.dumpOpts...)
+		in = io.TeeReader(conn, reqRec)
+		out = respRec
+		defer s.logDump(conn, reqRec, respRec)
+	}
+
+	writer := response.NewWriter(out)
+	writer.EnableAutoFraming(response.DefaultFramingThreshold)
+	writer.AddFilter(defaultHeaders{serverName: s.serverName})
+	request, err := request.RequestHeadFromReader(in)
 	if err != nil {
-		WriteResponse(conn, response.InternalServerError, 0)
+		log.Printf("error parsing request: %v", err)
+		s.writeError(writer, response.BadRequest, nil)
 		return
 	}
 
-	var buf bytes.Buffer
-	s.handler(&buf, request)
+	request.RemoteAddr = conn.RemoteAddr().String()
+	writer.SetRequest(request)
+	if _, ok := request.Headers.Get("Expect"); ok && !request.ExpectsContinue() {
+		s.writeError(writer, response.ExpectationFailed, nil)
+		return
+	}
+
+	if len(s.digestAlgs) > 0 {
+		request.VerifyDigests(s.digestAlgs...)
+	}
+
+	if err := s.limitBody(request); err != nil {
+		log.Printf("rejecting request body: %v", err)
+		s.writeBodyError(writer, err)
+		return
+	}
+
+	if request.ExpectsContinue() {
+		request.OnBodyRead(writer.WriteContinue)
+	} else if s.streamBodies {
+		defer func() {
+			// Send the response before draining what the handler left of
+			// the body, so the client isn't kept waiting on it.
+			bw.Flush()
+			io.Copy(io.Discard, request.BodyReader())
+		}()
+	} else if _, err := request.ReadBody(); err != nil {
+		log.Printf("error reading request body: %v", err)
+		s.writeBodyError(writer, err)
+		return
+	}
+
+	s.handler(writer, request)
+
+	// A body read by the handler itself can fail only once the handler
+	// runs. As long as nothing has gone out, the failure is answered the
+	// same way as if the server had read the body up front.
+	if err := request.BodyError(); err != nil && !writer.Committed() {
+		log.Printf("error reading request body: %v", err)
+		writer.Reset()
+		s.writeBodyError(writer, err)
+		return
+	}
 
-	_, err = buf.WriteTo(conn)
+	err = writer.Close()
 	if err != nil {
-		log.Printf("error writing the content to the connection. err: %e", err)
+		log.Printf("error completing the response. err: %v", err)
+	}
+}
+
+// logDump logs what was recorded of the exchange on conn.
+func (s *Server) logDump(conn net.Conn, req *dump.Recorder, resp *dump.Recorder) {
+	s.dumpLogger.Debug("connection dump",
+		"remote", conn.RemoteAddr().String(),
+		"request", string(req.Dump()),
+		"response", string(resp.Dump()),
+	)
+}
+
+// limitBody applies the body size limit and decoding options to req before
+// its body is read, so that requests which can't be accepted are refused
+// before any 100 Continue.
+func (s *Server) limitBody(req *request.Request) error {
+	if s.maxBodySize > 0 {
+		if err := req.LimitBody(s.maxBodySize); err != nil {
+			return err
+		}
+	}
+
+	if s.decompress {
+		return req.DecodeBody()
+	}
+	return nil
+}
+
+// writeBodyError answers a request whose body could not be read. Digest
+// failures tell the client which algorithms the server verifies.
+func (s *Server) writeBodyError(w *response.Writer, err error) {
+	h := headers.NewHeaders()
+	statusCode := response.BadRequest
+	switch {
+	case errors.Is(err, request.ErrDigestMismatch), errors.Is(err, request.ErrDigestUnsupported):
+		h.Set("Want-Content-Digest", digest.FormatWant(s.digestAlgs))
+	case errors.Is(err, request.ErrBodyTooLarge):
+		statusCode = response.PayloadTooLarge
+	case errors.Is(err, request.ErrUnsupportedEncoding):
+		statusCode = response.UnsupportedMedia
+		h.Set("Accept-Encoding", "gzip, deflate")
+	}
+
+	s.writeError(w, statusCode, h)
+}
+
+func (s *Server) writeError(w *response.Writer, statusCode response.StatusCode, h headers.Headers) {
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	h.Set("Connection", "close")
+	h.Set("Content-Type", "text/plain")
+
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+	if err := w.Close(); err != nil {
+		log.Printf("error writing the error response. err: %v", err)
 	}
 }
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mgmaster24/httpfromtcp/internal/digest"
+	"github.com/mgmaster24/httpfromtcp/internal/dump"
+	"github.com/mgmaster24/httpfromtcp/internal/headers"
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func roundTrip(t *testing.T, s *Server, raw string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(raw))
+	require.NoError(t, err)
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDump(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(5))
+		w.Write([]byte("hello"))
+	}
+
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s, err := Serve(0, handler, WithDump(logger, dump.WithBodyLimit(2)))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: Both sides are logged in wire format, bodies truncated
+	raw := "POST /echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nping"
+	resp := roundTrip(t, s, raw)
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello"))
+	line := logs.String()
+	assert.Contains(t, line, "level=DEBUG")
+	assert.Contains(t, line, `request="POST /echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\npi\n[2 more bytes]\n"`)
+	assert.Contains(t, line, `\r\n\r\nhe\n[3 more bytes]\n"`)
+
+	// Test: Requests that don't parse are dumped too
+	resp = roundTrip(t, s, "BROKEN\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, logs.String(), `request="BROKEN\r\n"`)
+
+	// Test: Nothing is logged above debug level
+	var quiet syncBuffer
+	logger = slog.New(slog.NewTextHandler(&quiet, nil))
+	s2, err := Serve(0, handler, WithDump(logger))
+	require.NoError(t, err)
+	defer s2.Close()
+	roundTrip(t, s2, raw)
+	assert.Empty(t, quiet.String())
+}
+
+func TestDumpExpectContinue(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.Write(body)
+	}
+
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s, err := Serve(0, handler, WithDump(logger))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: The 100 Continue isn't held back by the recorder
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(rest), "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(string(rest), "\r\n\r\nping"))
+	assert.Contains(t, logs.String(), `\r\n\r\nping"`)
+}
+
+func TestStreamingBodies(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget != "/echo" {
+			w.WriteStatusLine(response.Ok)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+			return
+		}
+
+		body, err := io.ReadAll(req.BodyReader())
+		if err != nil {
+			w.WriteStatusLine(response.BadRequest)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		}
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.Write(body)
+	}
+
+	s, err := Serve(0, handler, WithStreamingBodies(), WithMaxBodySize(16))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: The handler reads the body itself
+	resp := roundTrip(t, s, "POST /echo HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nping\r\n0\r\n\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nping"))
+
+	// Test: Failures reading it are answered as if the server had read it
+	resp = roundTrip(t, s, "POST /echo HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"14\r\n"+strings.Repeat("x", 20)+"\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: A body the handler ignores is drained
+	resp = roundTrip(t, s, "POST /ignore HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\n0123456789")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+}
+
+func TestLazyBodyErrors(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		if _, err := req.ReadBody(); err != nil {
+			w.WriteStatusLine(response.BadRequest)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		}
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+
+	s, err := Serve(0, handler, WithDigestVerification(digest.SHA256))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: A digest mismatch found after 100 Continue gets
+	// Want-Content-Digest like any other
+	resp := roundTrip(t, s, "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\n"+
+		"Content-Digest: sha-256=:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=:\r\n"+
+		"Content-Length: 4\r\n\r\nping")
+	final := resp[strings.Index(resp, "\r\n\r\n")+4:]
+	assert.True(t, strings.HasPrefix(final, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, final, "want-content-digest: sha-256=")
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+
+	s, err := Serve(0, handler, WithRequestDecompression())
+	require.NoError(t, err)
+	defer s.Close()
+
+	var bomb bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zw.Write(make([]byte, request.DefaultMaxDecodedSize+1))
+	zw.Close()
+
+	// Test: A gzip bomb is refused without WithMaxBodySize
+	resp := roundTrip(t, s, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: gzip\r\n"+
+		"Content-Length: "+strconv.Itoa(bomb.Len())+"\r\n\r\n"+bomb.String())
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+}
+
+func TestExpectContinue(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/reject" {
+			w.WriteStatusLine(response.PayloadTooLarge)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+			return
+		}
+
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.Write(body)
+	}
+
+	s, err := Serve(0, handler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	dial := func(target string) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", s.listener.Addr().String())
+		require.NoError(t, err)
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		_, err = conn.Write([]byte("POST " + target + " HTTP/1.1\r\nHost: localhost\r\n" +
+			"Expect: 100-continue\r\nContent-Length: 4\r\n\r\n"))
+		require.NoError(t, err)
+		return conn, bufio.NewReader(conn)
+	}
+
+	// Test: 100 Continue arrives before the body is sent, and the final
+	// response after it
+	conn, reader := dial("/upload")
+	defer conn.Close()
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	blank, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", blank)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(rest), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(rest), "\r\n\r\nping"))
+
+	// Test: A handler that rejects the upload without reading it sends
+	// the final response with no 100 Continue
+	conn, reader = dial("/reject")
+	defer conn.Close()
+	rest, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(rest), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.NotContains(t, string(rest), "100 Continue")
+}
@@ -0,0 +1,132 @@
+package vhost
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/mgmaster24/httpfromtcp/internal/server"
+)
+
+const unknownHostBody = "Unknown host\n"
+
+// Router dispatches each request to the handler registered for the host
+// named in its Host header. Patterns are either an exact host such as
+// "example.com" or a wildcard such as "*.example.com", which matches every
+// subdomain of example.com but not example.com itself. Exact matches win
+// over wildcards and longer wildcards win over shorter ones. Requests that
+// match nothing go to the default handler, or get a 404 if none is set.
+type Router struct {
+	exact          map[string]server.Handler
+	wildcards      map[string]server.Handler
+	defaultHandler server.Handler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		exact:     make(map[string]server.Handler),
+		wildcards: make(map[string]server.Handler),
+	}
+}
+
+func (r *Router) Register(pattern string, handler server.Handler) error {
+	host := normalizeHost(pattern)
+	if host == "" {
+		return fmt.Errorf("empty host pattern")
+	}
+
+	if strings.HasPrefix(host, "*") {
+		suffix := strings.TrimPrefix(host, "*")
+		if !strings.HasPrefix(suffix, ".") || len(suffix) == 1 || strings.Contains(suffix, "*") {
+			return fmt.Errorf("invalid wildcard host pattern: %s", pattern)
+		}
+
+		if _, ok := r.wildcards[suffix]; ok {
+			return fmt.Errorf("host pattern already registered: %s", pattern)
+		}
+
+		r.wildcards[suffix] = handler
+		return nil
+	}
+
+	if strings.Contains(host, "*") {
+		return fmt.Errorf("invalid host pattern: %s", pattern)
+	}
+
+	if _, ok := r.exact[host]; ok {
+		return fmt.Errorf("host pattern already registered: %s", pattern)
+	}
+
+	r.exact[host] = handler
+	return nil
+}
+
+// SetDefault sets the handler used for requests whose host matches no
+// registered pattern.
+func (r *Router) SetDefault(handler server.Handler) {
+	r.defaultHandler = handler
+}
+
+// Handle implements server.Handler.
+func (r *Router) Handle(w *response.Writer, req *request.Request) {
+	host, _ := req.Headers.Get("Host")
+	handler := r.match(normalizeHost(host))
+	if handler == nil {
+		w.WriteStatusLine(response.NotFound)
+		w.WriteHeaders(response.GetDefaultHeaders(len(unknownHostBody)))
+		w.WriteBody([]byte(unknownHostBody))
+		return
+	}
+
+	handler(w, req)
+}
+
+func (r *Router) match(host string) server.Handler {
+	if handler, ok := r.exact[host]; ok {
+		return handler
+	}
+
+	// Walk the labels from the most to the least specific suffix so that
+	// *.api.example.com is preferred over *.example.com.
+	for i := strings.Index(host, "."); i != -1; {
+		if handler, ok := r.wildcards[host[i:]]; ok {
+			return handler
+		}
+
+		next := strings.Index(host[i+1:], ".")
+		if next == -1 {
+			break
+		}
+		i += next + 1
+	}
+
+	return r.defaultHandler
+}
+
+// normalizeHost lowercases a Host value and strips the port and any
+// trailing dot. IPv6 literals lose their brackets.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if strings.HasPrefix(host, "[") {
+		if end := strings.Index(host, "]"); end != -1 {
+			return host[1:end]
+		}
+		return host
+	}
+
+	if idx := strings.LastIndex(host, ":"); idx != -1 && isPort(host[idx+1:]) {
+		host = host[:idx]
+	}
+
+	return strings.TrimSuffix(host, ".")
+}
+
+func isPort(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
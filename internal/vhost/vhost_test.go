@@ -0,0 +1,68 @@
+package vhost
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mgmaster24/httpfromtcp/internal/request"
+	"github.com/mgmaster24/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func namedHandler(name string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		w.Writer.Write([]byte(name))
+	}
+}
+
+func serve(t *testing.T, r *Router, host string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(
+		strings.NewReader("GET / HTTP/1.1\r\nHost: " + host + "\r\n\r\n"),
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	r.Handle(response.NewWriter(&buf), req)
+	return buf.String()
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := NewRouter()
+	require.NoError(t, r.Register("example.com", namedHandler("apex")))
+	require.NoError(t, r.Register("*.example.com", namedHandler("wildcard")))
+	require.NoError(t, r.Register("*.api.example.com", namedHandler("api")))
+	require.NoError(t, r.Register("[::1]", namedHandler("ipv6")))
+
+	// Test: Exact match, ignoring case, port and trailing dot
+	assert.Equal(t, "apex", serve(t, r, "Example.COM:8080"))
+	assert.Equal(t, "apex", serve(t, r, "example.com."))
+
+	// Test: Wildcards match any depth, most specific first
+	assert.Equal(t, "wildcard", serve(t, r, "www.example.com"))
+	assert.Equal(t, "wildcard", serve(t, r, "a.b.example.com"))
+	assert.Equal(t, "api", serve(t, r, "v1.api.example.com"))
+
+	// Test: IPv6 literal
+	assert.Equal(t, "ipv6", serve(t, r, "[::1]:42069"))
+
+	// Test: Unknown host without a default
+	assert.Contains(t, serve(t, r, "other.org"), "HTTP/1.1 404 Not Found")
+
+	// Test: Unknown host with a default
+	r.SetDefault(namedHandler("default"))
+	assert.Equal(t, "default", serve(t, r, "other.org"))
+	assert.Equal(t, "default", serve(t, r, ""))
+}
+
+func TestRouterRegister(t *testing.T) {
+	r := NewRouter()
+	require.NoError(t, r.Register("example.com", namedHandler("a")))
+	assert.Error(t, r.Register("EXAMPLE.com", namedHandler("b")))
+	assert.Error(t, r.Register("", namedHandler("b")))
+	assert.Error(t, r.Register("*", namedHandler("b")))
+	assert.Error(t, r.Register("*example.com", namedHandler("b")))
+	assert.Error(t, r.Register("www.*.example.com", namedHandler("b")))
+}